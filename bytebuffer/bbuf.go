@@ -3,6 +3,7 @@ package bytebuffer
 import (
 	"encoding/binary"
 	"io"
+	"math"
 )
 
 type bbuf struct {
@@ -207,6 +208,46 @@ func (bb *bbuf) GetUint64() uint64 {
 	return ui
 }
 
+func (bb *bbuf) PutInt16(i int16) ByteBuffer {
+	return bb.PutUint16(uint16(i))
+}
+
+func (bb *bbuf) GetInt16() int16 {
+	return int16(bb.GetUint16())
+}
+
+func (bb *bbuf) PutInt32(i int32) ByteBuffer {
+	return bb.PutUint32(uint32(i))
+}
+
+func (bb *bbuf) GetInt32() int32 {
+	return int32(bb.GetUint32())
+}
+
+func (bb *bbuf) PutInt64(i int64) ByteBuffer {
+	return bb.PutUint64(uint64(i))
+}
+
+func (bb *bbuf) GetInt64() int64 {
+	return int64(bb.GetUint64())
+}
+
+func (bb *bbuf) PutFloat32(f float32) ByteBuffer {
+	return bb.PutUint32(math.Float32bits(f))
+}
+
+func (bb *bbuf) GetFloat32() float32 {
+	return math.Float32frombits(bb.GetUint32())
+}
+
+func (bb *bbuf) PutFloat64(f float64) ByteBuffer {
+	return bb.PutUint64(math.Float64bits(f))
+}
+
+func (bb *bbuf) GetFloat64() float64 {
+	return math.Float64frombits(bb.GetUint64())
+}
+
 func (bb *bbuf) PutAll(dat ...interface{}) ByteBuffer {
 	if bb.position+lenOf(dat...) > cap(bb.buf) {
 		panic(ErrOverflow)
@@ -223,6 +264,16 @@ func (bb *bbuf) PutAll(dat ...interface{}) ByteBuffer {
 			bb.PutUint32(t)
 		case uint64:
 			bb.PutUint64(t)
+		case int16:
+			bb.PutInt16(t)
+		case int32:
+			bb.PutInt32(t)
+		case int64:
+			bb.PutInt64(t)
+		case float32:
+			bb.PutFloat32(t)
+		case float64:
+			bb.PutFloat64(t)
 		case Binary:
 			bb.PutN(t.Bytes())
 		}
@@ -238,11 +289,11 @@ func lenOf(dat ...interface{}) int {
 			n += 1
 		case []byte:
 			n += len(t)
-		case uint16:
+		case uint16, int16:
 			n += 2
-		case uint32:
+		case uint32, int32, float32:
 			n += 4
-		case uint64:
+		case uint64, int64, float64:
 			n += 8
 		case Binary:
 			n += len(t.Bytes())
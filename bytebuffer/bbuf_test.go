@@ -247,8 +247,16 @@ func TestPutAll(t *testing.T) {
 	checkErrCase(t, ErrUnderflow, func() { bb.Get() })
 
 	bb.Clear()
-	checkErrCase(t, ErrType, func() { bb.PutAll(int16(2)) })
-	checkErrCase(t, ErrType, func() { bb.PutAll(float32(3.14)) })
+	checkErrCase(t, ErrType, func() { bb.PutAll(int(2)) })
+	checkErrCase(t, ErrType, func() { bb.PutAll("3.14") })
+
+	bb.PutAll(int16(-2), int32(-3), int64(-4), float32(3.5), float64(-0.25)) // 26 bytes
+	checkCursors(t, bb, 32, 26, 32)
+	bb.Flip()
+	if bb.GetInt16() != -2 || bb.GetInt32() != -3 || bb.GetInt64() != -4 ||
+		bb.GetFloat32() != 3.5 || bb.GetFloat64() != -0.25 {
+		t.Error("numbers: wanted -2,-3,-4,3.5,-0.25")
+	}
 }
 
 func TestGetN(t *testing.T) {
@@ -399,6 +407,36 @@ func checkIntOrder(t *testing.T, bb ByteBuffer, order bi.ByteOrder,
 	}
 }
 
+func TestSignedAndFloatOrder(t *testing.T) {
+	cases := []struct {
+		order  bi.ByteOrder
+		put    func(ByteBuffer)
+		wanted []byte
+	}{
+		{bi.BigEndian, func(bb ByteBuffer) { bb.PutInt16(-2) }, []byte{0xFF, 0xFE}},
+		{bi.LittleEndian, func(bb ByteBuffer) { bb.PutInt16(-2) }, []byte{0xFE, 0xFF}},
+		{bi.BigEndian, func(bb ByteBuffer) { bb.PutInt32(-2) }, []byte{0xFF, 0xFF, 0xFF, 0xFE}},
+		{bi.LittleEndian, func(bb ByteBuffer) { bb.PutInt32(-2) }, []byte{0xFE, 0xFF, 0xFF, 0xFF}},
+		{bi.BigEndian, func(bb ByteBuffer) { bb.PutInt64(-2) },
+			[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}},
+		{bi.LittleEndian, func(bb ByteBuffer) { bb.PutInt64(-2) },
+			[]byte{0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{bi.BigEndian, func(bb ByteBuffer) { bb.PutFloat32(1) }, []byte{0x3F, 0x80, 0, 0}},
+		{bi.LittleEndian, func(bb ByteBuffer) { bb.PutFloat32(1) }, []byte{0, 0, 0x80, 0x3F}},
+		{bi.BigEndian, func(bb ByteBuffer) { bb.PutFloat64(1) }, []byte{0x3F, 0xF0, 0, 0, 0, 0, 0, 0}},
+		{bi.LittleEndian, func(bb ByteBuffer) { bb.PutFloat64(1) }, []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F}},
+	}
+	for _, bb := range []ByteBuffer{New(8), NewBB(8)} {
+		for _, c := range cases {
+			bb.Clear().OrderTo(c.order)
+			c.put(bb)
+			if got := bb.Flip().GetN(bb.Remaining()); !bytes.Equal(got, c.wanted) {
+				t.Errorf("%T %v: wanted %x, got %x\n", bb, c.order, c.wanted, got)
+			}
+		}
+	}
+}
+
 func TestWrap(t *testing.T) {
 	cases := []byte{0, 1, 127, 128, 255}
 	bb := Wrap(cases)
@@ -498,6 +536,94 @@ func TestUint64Access(t *testing.T) {
 	checkErrCase(t, ErrUnderflow, func() { bb.GetUint64() })
 }
 
+func TestInt16Access(t *testing.T) {
+	cases := []int16{0, 1, -1, math.MaxInt16, math.MinInt16}
+	bb := New(len(cases) * 2)
+	bb.OrderTo(bi.BigEndian)
+
+	for _, c := range cases {
+		bb.PutInt16(c)
+	}
+	checkErrCase(t, ErrOverflow, func() { bb.PutInt16(2) })
+
+	bb.Flip()
+	for _, wanted := range cases {
+		b := bb.GetInt16()
+		if wanted != b {
+			t.Errorf("wanted:%d, got:%d\n", wanted, b)
+		}
+	}
+	checkErrCase(t, ErrUnderflow, func() { bb.GetInt16() })
+}
+
+func TestInt32Access(t *testing.T) {
+	cases := []int32{0, 1, -1, math.MaxInt32, math.MinInt32}
+	bb := New(len(cases) * 4)
+
+	for _, c := range cases {
+		bb.PutInt32(c)
+	}
+	checkErrCase(t, ErrOverflow, func() { bb.PutInt32(2) })
+
+	bb.Flip()
+	for _, wanted := range cases {
+		b := bb.GetInt32()
+		if wanted != b {
+			t.Errorf("wanted:%d, got:%d\n", wanted, b)
+		}
+	}
+	checkErrCase(t, ErrUnderflow, func() { bb.GetInt32() })
+}
+
+func TestInt64Access(t *testing.T) {
+	cases := []int64{0, 1, -1, math.MaxInt64, math.MinInt64}
+	bb := New(len(cases) * 8)
+
+	for _, c := range cases {
+		bb.PutInt64(c)
+	}
+	checkErrCase(t, ErrOverflow, func() { bb.PutInt64(2) })
+
+	bb.Flip()
+	for _, wanted := range cases {
+		b := bb.GetInt64()
+		if wanted != b {
+			t.Errorf("wanted:%d, got:%d\n", wanted, b)
+		}
+	}
+	checkErrCase(t, ErrUnderflow, func() { bb.GetInt64() })
+}
+
+func TestFloatAccess(t *testing.T) {
+	cases := []float64{0, -1.5, math.Pi, math.MaxFloat64, math.SmallestNonzeroFloat64,
+		math.Inf(-1)}
+	bb := New(len(cases) * (4 + 8))
+
+	for _, c := range cases {
+		bb.PutFloat32(float32(c)).PutFloat64(c)
+	}
+	checkErrCase(t, ErrOverflow, func() { bb.PutFloat32(2) })
+	checkErrCase(t, ErrOverflow, func() { bb.PutFloat64(2) })
+
+	bb.Flip()
+	for _, wanted := range cases {
+		if f := bb.GetFloat32(); float32(wanted) != f {
+			t.Errorf("wanted:%g, got:%g\n", float32(wanted), f)
+		}
+		if f := bb.GetFloat64(); wanted != f {
+			t.Errorf("wanted:%g, got:%g\n", wanted, f)
+		}
+	}
+	checkErrCase(t, ErrUnderflow, func() { bb.GetFloat32() })
+	checkErrCase(t, ErrUnderflow, func() { bb.GetFloat64() })
+
+	bb.Clear()
+	bb.PutFloat64(math.NaN())
+	if f := bb.Flip().GetFloat64(); !math.IsNaN(f) {
+		t.Errorf("wanted:NaN, got:%g\n", f)
+	}
+}
+
 func TestCapacity(t *testing.T) {
 	bb := New(16)
 	checkCursors(t, bb, 16, 0, 16)
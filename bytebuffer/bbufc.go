@@ -1,6 +1,9 @@
 package bytebuffer
 
-import us "unsafe"
+import (
+	"math"
+	us "unsafe"
+)
 
 type bbufc struct {
 	bbuf
@@ -178,6 +181,46 @@ func (bb *bbufc) GetUint64() uint64 {
 	return i
 }
 
+func (bb *bbufc) PutInt16(i int16) ByteBuffer {
+	return bb.PutUint16(uint16(i))
+}
+
+func (bb *bbufc) GetInt16() int16 {
+	return int16(bb.GetUint16())
+}
+
+func (bb *bbufc) PutInt32(i int32) ByteBuffer {
+	return bb.PutUint32(uint32(i))
+}
+
+func (bb *bbufc) GetInt32() int32 {
+	return int32(bb.GetUint32())
+}
+
+func (bb *bbufc) PutInt64(i int64) ByteBuffer {
+	return bb.PutUint64(uint64(i))
+}
+
+func (bb *bbufc) GetInt64() int64 {
+	return int64(bb.GetUint64())
+}
+
+func (bb *bbufc) PutFloat32(f float32) ByteBuffer {
+	return bb.PutUint32(math.Float32bits(f))
+}
+
+func (bb *bbufc) GetFloat32() float32 {
+	return math.Float32frombits(bb.GetUint32())
+}
+
+func (bb *bbufc) PutFloat64(f float64) ByteBuffer {
+	return bb.PutUint64(math.Float64bits(f))
+}
+
+func (bb *bbufc) GetFloat64() float64 {
+	return math.Float64frombits(bb.GetUint64())
+}
+
 func min(a, b int) int {
 	if a <= b {
 		return a
@@ -101,3 +101,45 @@ func TestUint16Access_C(t *testing.T) {
 	}
 	checkErrCase(t, ErrUnderflow, func() { bb.GetUint16() })
 }
+
+func TestInt64Access_C(t *testing.T) {
+	cases := []int64{0, 1, -1, math.MaxInt64, math.MinInt64}
+	bb := NewBB(len(cases) * 8)
+	bb.OrderTo(bi.BigEndian)
+
+	for _, c := range cases {
+		bb.PutInt64(c)
+	}
+	checkErrCase(t, ErrOverflow, func() { bb.PutInt64(2) })
+
+	bb.Flip()
+	for _, wanted := range cases {
+		b := bb.GetInt64()
+		if wanted != b {
+			t.Errorf("wanted:%d, got:%d\n", wanted, b)
+		}
+	}
+	checkErrCase(t, ErrUnderflow, func() { bb.GetInt64() })
+}
+
+func TestFloatAccess_C(t *testing.T) {
+	cases := []float64{0, -1.5, math.Pi, math.MaxFloat64, math.Inf(1)}
+	bb := NewBB(len(cases) * (4 + 8))
+	bb.OrderTo(bi.BigEndian)
+
+	for _, c := range cases {
+		bb.PutFloat32(float32(c)).PutFloat64(c)
+	}
+	checkErrCase(t, ErrOverflow, func() { bb.PutFloat32(2) })
+
+	bb.Flip()
+	for _, wanted := range cases {
+		if f := bb.GetFloat32(); float32(wanted) != f {
+			t.Errorf("wanted:%g, got:%g\n", float32(wanted), f)
+		}
+		if f := bb.GetFloat64(); wanted != f {
+			t.Errorf("wanted:%g, got:%g\n", wanted, f)
+		}
+	}
+	checkErrCase(t, ErrUnderflow, func() { bb.GetFloat64() })
+}
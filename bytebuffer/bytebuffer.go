@@ -48,9 +48,10 @@ func init() {
 }
 
 // ByteBuffer is a fix-sized buffer of bytes with Read and Write methods. Bytes
-// are read and written as are, whereas wider unsigned integers are read and
-// written according to this ByteBuffer's byte order, which defaults to the
-// platform's endianness.
+// are read and written as are, whereas wider integers and floating-point
+// numbers are read and written according to this ByteBuffer's byte order,
+// which defaults to the platform's endianness. Signed integers are in two's
+// complement, floating-point numbers in IEEE 754 format.
 //
 // Reading operations are performed from position to limit.
 // Writing operations are performed from position to capacity.
@@ -149,6 +150,46 @@ type ByteBuffer interface {
 	// by 8, panics if less than 8 bytes left for reading.
 	GetUint64() uint64
 
+	// PutInt16 writes i into this ByteBuffer from the current position and
+	// advances position by 2, panics if less than 2 bytes left for writing.
+	PutInt16(i int16) ByteBuffer
+
+	// GetInt16 returns an int16 from the current position and advances position
+	// by 2, panics if less than 2 bytes left for reading.
+	GetInt16() int16
+
+	// PutInt32 writes i into this ByteBuffer from the current position and
+	// advances position by 4, panics if less than 4 bytes left for writing.
+	PutInt32(i int32) ByteBuffer
+
+	// GetInt32 returns an int32 from the current position and advances position
+	// by 4, panics if less than 4 bytes left for reading.
+	GetInt32() int32
+
+	// PutInt64 writes i into this ByteBuffer from the current position and
+	// advances position by 8, panics if less than 8 bytes left for writing.
+	PutInt64(i int64) ByteBuffer
+
+	// GetInt64 returns an int64 from the current position and advances position
+	// by 8, panics if less than 8 bytes left for reading.
+	GetInt64() int64
+
+	// PutFloat32 writes f into this ByteBuffer from the current position and
+	// advances position by 4, panics if less than 4 bytes left for writing.
+	PutFloat32(f float32) ByteBuffer
+
+	// GetFloat32 returns a float32 from the current position and advances
+	// position by 4, panics if less than 4 bytes left for reading.
+	GetFloat32() float32
+
+	// PutFloat64 writes f into this ByteBuffer from the current position and
+	// advances position by 8, panics if less than 8 bytes left for writing.
+	PutFloat64(f float64) ByteBuffer
+
+	// GetFloat64 returns a float64 from the current position and advances
+	// position by 8, panics if less than 8 bytes left for reading.
+	GetFloat64() float64
+
 	// PutAll writes the given dat into this ByteBuffer from the current position
 	// advances position by the total length of dat, panics if dat type is not
 	// supported or this ByteBuffer cannot hold all of dat.
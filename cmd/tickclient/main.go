@@ -0,0 +1,128 @@
+// Command tickclient connects to a tickserver and prints, counts or records
+// the frames received.
+//
+//	tickclient -addr localhost:7979 -sub EURUSD
+//	tickclient -ticks
+//	tickclient -mode count
+//	tickclient -mode record -out ticks.rec
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/kenix/gomad/comm"
+	sp "github.com/kenix/gomad/supplier"
+	"github.com/kenix/gomad/util"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:7979", "TCP address or unix://path of the server")
+	sub := flag.String("sub", "", "comma separated topics to subscribe to")
+	mode := flag.String("mode", "print", "print, count or record frames")
+	out := flag.String("out", "ticks.rec", "record file, an sdb file if ending with .sdb")
+	n := flag.Uint64("n", 0, "frames to receive, 0 for unlimited")
+	timeout := flag.Duration("timeout", 0, "time without frames after which to reconnect")
+	ticks := flag.Bool("ticks", false, "decode printed frames as binary ticks")
+	flag.Parse()
+
+	var cmds []string
+	if *sub != "" {
+		cmds = append(cmds, comm.CmdSubscribe+" "+strings.Replace(*sub, ",", " ", -1))
+	}
+	s := comm.NewSubscriber(*addr, cmds...)
+	s.Timeout = *timeout
+	if path := strings.TrimPrefix(*addr, "unix://"); path != *addr {
+		s.Dial = func(string) (net.Conn, error) { return net.Dial("unix", path) }
+	}
+	if err := s.Connect(); err != nil {
+		util.Lf.Fatalf("failed connecting to %s: %s\n", *addr, err)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		s.Close()
+	}()
+
+	start := time.Now()
+	var frames, bytes uint64
+	var err error
+	switch *mode {
+	case "print", "count":
+		if *mode == "count" {
+			go report(&frames, &bytes)
+		}
+		for *n == 0 || frames < *n {
+			var f comm.Frame
+			if f, err = s.Next(); err != nil {
+				break
+			}
+			atomic.AddUint64(&frames, 1)
+			atomic.AddUint64(&bytes, uint64(len(f.Data)))
+			if *mode == "print" {
+				printFrame(f, *ticks)
+			}
+		}
+		s.Close()
+	case "record":
+		var w comm.RecordWriter
+		if w, err = createRecords(*out); err != nil {
+			util.Lf.Fatalf("failed creating %q: %s\n", *out, err)
+		}
+		rec := comm.NewRecorder(s, w)
+		err = rec.Run()
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		frames = rec.Recorded()
+	default:
+		util.Lf.Fatalf("unknown mode %q\n", *mode)
+	}
+	if err != nil && err != comm.ErrClosed {
+		util.Le.Printf("stopped receiving: %s\n", err)
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(os.Stderr, "%d frame(s), %d byte(s) of data in %s, %.1f frame(s)/s, %d reconnect(s)\n",
+		atomic.LoadUint64(&frames), atomic.LoadUint64(&bytes), elapsed.Round(time.Millisecond),
+		float64(atomic.LoadUint64(&frames))/elapsed.Seconds(), s.Reconnects())
+}
+
+// printFrame prints a frame, its data decoded as ticks if ticks.
+func printFrame(f comm.Frame, ticks bool) {
+	if !ticks {
+		fmt.Printf("%d %s %s\n", f.Seq, f.Topic, f.Data)
+		return
+	}
+	ts, err := sp.DecodeTicks(f.Data)
+	if err != nil {
+		util.Lw.Printf("frame %d: %s\n", f.Seq, err)
+	}
+	for _, t := range ts {
+		fmt.Printf("%d %s %s\n", f.Seq, f.Topic, &t)
+	}
+}
+
+func createRecords(path string) (comm.RecordWriter, error) {
+	if strings.HasSuffix(path, ".sdb") {
+		return comm.CreateRecordDB(path)
+	}
+	return comm.CreateRecordFile(path)
+}
+
+// report prints the frames and bytes received per second.
+func report(frames, bytes *uint64) {
+	var lastFrames, lastBytes uint64
+	for range time.Tick(time.Second) {
+		f, b := atomic.LoadUint64(frames), atomic.LoadUint64(bytes)
+		fmt.Fprintf(os.Stderr, "%d frame(s)/s, %d byte(s)/s\n", f-lastFrames, b-lastBytes)
+		lastFrames, lastBytes = f, b
+	}
+}
@@ -0,0 +1,152 @@
+// Command tickserver broadcasts ticks to TCP clients, for demos and load
+// tests of package comm.
+//
+//	tickserver -addr :7979 -supplier random -symbols EURUSD,USDJPY
+//	tickserver -binary
+//	tickserver -supplier replay -file ticks.rec -speed 2
+//	tickserver -supplier file -file ticks.txt
+//	tickserver -supplier ticks -file ticks.csv -columns sym,ts,bid,ask,,qty -timeformat unixms -speed 10
+//	tail -f ticks.txt | tickserver -supplier stdin
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kenix/gomad/comm"
+	sp "github.com/kenix/gomad/supplier"
+	"github.com/kenix/gomad/util"
+)
+
+func main() {
+	addr := flag.String("addr", ":7979", "TCP address or unix://path to listen on")
+	interval := flag.Duration("interval", 100*time.Millisecond, "interval of polled suppliers")
+	supplier := flag.String("supplier", "random", "data supplier: random, replay, file, ticks or stdin")
+	symbols := flag.String("symbols", "EURUSD,USDJPY,GBPUSD", "comma separated symbols of random ticks")
+	binary := flag.Bool("binary", false, "encode random ticks in binary instead of text")
+	file := flag.String("file", "", "record file to replay, an sdb file if ending with .sdb, text, CSV or JSON Lines file")
+	columns := flag.String("columns", "symbol,time,bid,ask,last,volume", "CSV columns or JSON keys of symbol, time, bid, ask, last and volume of ticks")
+	timeFormat := flag.String("timeformat", "", "time layout of ticks or unix, unixms, unixus, unixns; RFC 3339 if empty")
+	speed := flag.Float64("speed", 1, "replay speed, 0 as fast as possible")
+	queue := flag.Int("queue", 256, "queue size per client")
+	replay := flag.Int("replay", 0, "frames retained for replay to reconnecting clients")
+	heartbeat := flag.Duration("heartbeat", 0, "idle time after which heartbeats are sent")
+	admin := flag.String("admin", "", "HTTP address serving /stats and /metrics")
+	ws := flag.String("ws", "", "HTTP address serving WebSocket clients at /")
+	logFormat := flag.String("log", "util", "log format: util, text or json")
+	flag.Parse()
+
+	var s sp.Supplier
+	switch *supplier {
+	case "random":
+		rt := sp.NewRandomTicks(time.Now().UnixNano(), strings.Split(*symbols, ",")...)
+		rt.Binary = *binary
+		s = rt
+	case "replay":
+		r, err := openRecords(*file)
+		if err != nil {
+			util.Lf.Fatalf("failed opening %q: %s\n", *file, err)
+		}
+		defer r.Close()
+		rs := comm.NewReplaySupplier(r, *speed, "")
+		defer rs.Close()
+		s = rs
+	case "file":
+		rd, err := sp.OpenFile(*file)
+		if err != nil {
+			util.Lf.Fatalf("failed opening %q: %s\n", *file, err)
+		}
+		defer rd.Close()
+		s = rd
+	case "ticks":
+		tf, err := tickFormat(*columns, *timeFormat, *speed)
+		if err != nil {
+			util.Lf.Fatalf("invalid columns %q: %s\n", *columns, err)
+		}
+		ts, err := sp.OpenTicks(*file, tf)
+		if err != nil {
+			util.Lf.Fatalf("failed opening %q: %s\n", *file, err)
+		}
+		defer ts.Close()
+		s = ts
+	case "stdin":
+		s = sp.NewReader(os.Stdin, nil)
+	default:
+		util.Lf.Fatalf("unknown supplier %q\n", *supplier)
+	}
+
+	opts := []comm.Option{comm.WithInterval(*interval), comm.WithQueue(*queue, comm.DropOldest)}
+	if *replay > 0 {
+		opts = append(opts, comm.WithReplay(*replay))
+	}
+	if *heartbeat > 0 {
+		opts = append(opts, comm.WithHeartbeat(*heartbeat))
+	}
+	switch *logFormat {
+	case "util":
+	case "text":
+		opts = append(opts, comm.WithLogger(slog.New(slog.NewTextHandler(os.Stderr, nil))))
+	case "json":
+		opts = append(opts, comm.WithLogger(slog.New(slog.NewJSONHandler(os.Stderr, nil))))
+	default:
+		util.Lf.Fatalf("unknown log format %q\n", *logFormat)
+	}
+	srv := comm.NewServer(*addr, s, opts...)
+	if err := srv.Start(); err != nil {
+		util.Lf.Fatalf("failed starting server on %s: %s\n", *addr, err)
+	}
+	util.Li.Printf("serving %s ticks on %s\n", *supplier, srv.Addr())
+	if *admin != "" {
+		go serveHTTP(*admin, srv.AdminHandler())
+	}
+	if *ws != "" {
+		go serveHTTP(*ws, srv.WebSocketHandler(comm.WSJSON))
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case <-srv.Exhausted():
+		util.Li.Printf("%s supplier exhausted\n", *supplier)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := srv.Shutdown(ctx); err != nil {
+		util.Lw.Printf("shut down: %s\n", err)
+	}
+	st := srv.Stats()
+	util.Li.Printf("sent %d message(s), %d byte(s), dropped %d\n", st.Messages, st.Bytes, st.Drops)
+}
+
+func openRecords(path string) (comm.RecordReader, error) {
+	if strings.HasSuffix(path, ".sdb") {
+		return comm.OpenRecordDB(path)
+	}
+	return comm.OpenRecordFile(path)
+}
+
+// tickFormat returns the format of ticks with comma separated columns, empty
+// for those absent.
+func tickFormat(columns, timeFormat string, speed float64) (sp.TickFormat, error) {
+	cols := strings.Split(columns, ",")
+	if len(cols) != 6 {
+		return sp.TickFormat{}, fmt.Errorf("wanted 6 columns, got %d", len(cols))
+	}
+	return sp.TickFormat{Symbol: cols[0], Time: cols[1], Bid: cols[2], Ask: cols[3],
+		Last: cols[4], Volume: cols[5], TimeFormat: timeFormat, Speed: speed}, nil
+}
+
+func serveHTTP(addr string, h http.Handler) {
+	if err := http.ListenAndServe(addr, h); err != nil {
+		util.Le.Printf("failed serving HTTP on %s: %s\n", addr, err)
+	}
+}
@@ -0,0 +1,79 @@
+package comm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// AdminHandler returns an http.Handler serving the server's statistics as JSON
+// under /stats and in Prometheus text format under /metrics.
+func (srv *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(srv.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, srv.Stats())
+	})
+	return mux
+}
+
+func writeMetrics(w io.Writer, st Stats) {
+	metric := func(name, typ, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+			name, help, name, typ, name, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	metric("comm_uptime_seconds", "gauge", "Time since the server started.", st.Uptime.Seconds())
+	metric("comm_clients", "gauge", "Number of connected clients.", float64(len(st.Clients)))
+	metric("comm_broadcasts_total", "counter", "Data received from suppliers.", float64(st.Broadcasts))
+	metric("comm_supplied_bytes_total", "counter", "Bytes received from suppliers.", float64(st.Supplied))
+	metric("comm_supplier_errors_total", "counter", "Errors reported by suppliers.", float64(st.SupplierErrors))
+	metric("comm_sent_bytes_total", "counter", "Bytes sent to clients.", float64(st.Bytes))
+	metric("comm_sent_messages_total", "counter", "Data sent to clients.", float64(st.Messages))
+	metric("comm_drops_total", "counter", "Data dropped for slow clients.", float64(st.Drops))
+
+	reasons := make([]string, 0, len(st.Rejected))
+	for reason := range st.Rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(w, "# HELP comm_rejected_total Connections rejected.\n# TYPE comm_rejected_total counter\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "comm_rejected_total{reason=%q} %d\n", reason, st.Rejected[reason])
+	}
+
+	clients := append([]ClientStats(nil), st.Clients...)
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Remote < clients[j].Remote })
+	perClient := []struct {
+		name, typ, help string
+		value           func(c ClientStats) float64
+	}{
+		{"comm_client_sent_bytes_total", "counter", "Bytes sent to the client.",
+			func(c ClientStats) float64 { return float64(c.Bytes) }},
+		{"comm_client_sent_messages_total", "counter", "Data sent to the client.",
+			func(c ClientStats) float64 { return float64(c.Messages) }},
+		{"comm_client_queue_depth", "gauge", "Data queued for the client.",
+			func(c ClientStats) float64 { return float64(c.Queued) }},
+		{"comm_client_drops_total", "counter", "Data dropped for the client.",
+			func(c ClientStats) float64 { return float64(c.Drops) }},
+		{"comm_client_connected_seconds", "gauge", "Connect time of the client since epoch.",
+			func(c ClientStats) float64 { return float64(c.Connected.UnixNano()) / 1e9 }},
+	}
+	for _, m := range perClient {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, c := range clients {
+			fmt.Fprintf(w, "%s{remote=%q} %s\n", m.name, c.Remote,
+				strconv.FormatFloat(m.value(c), 'g', -1, 64))
+		}
+	}
+}
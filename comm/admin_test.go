@@ -0,0 +1,47 @@
+package comm
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	srv := startServer(t)
+	defer srv.Stop()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	h := srv.AdminHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var st Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Clients) != 1 || st.Clients[0].Bytes == 0 || st.Broadcasts == 0 {
+		t.Errorf("wanted 1 client with bytes sent, got %+v\n", st)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"comm_clients 1\n", "# TYPE comm_sent_bytes_total counter\n",
+		"comm_client_queue_depth{remote=\"" + conn.LocalAddr().String() + "\"}"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("wanted %q in\n%s", want, body)
+		}
+	}
+}
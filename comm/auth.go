@@ -0,0 +1,38 @@
+package comm
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// Authenticator decides if a connection may join the broadcast set, a non nil
+// error rejects it. For TLS connections the handshake is completed before, so
+// the peer certificates are available via the connection state. An
+// authenticator reading from conn must not read beyond its own messages.
+// WebSocket connections carry their upgrade request, see UpgradeRequest.
+type Authenticator func(conn net.Conn) error
+
+var ErrUnauthorized = errors.New("comm: unauthorized")
+
+// CommonNames returns an Authenticator accepting TLS connections whose verified
+// client certificate has one of the given common names, including WebSocket
+// connections upgraded from HTTPS.
+func CommonNames(names ...string) Authenticator {
+	allowed := make(map[string]bool, len(names))
+	for _, n := range names {
+		allowed[n] = true
+	}
+	return func(conn net.Conn) error {
+		tc, ok := conn.(interface{ ConnectionState() tls.ConnectionState })
+		if !ok {
+			return ErrUnauthorized
+		}
+		for _, chain := range tc.ConnectionState().VerifiedChains {
+			if len(chain) > 0 && allowed[chain[0].Subject.CommonName] {
+				return nil
+			}
+		}
+		return ErrUnauthorized
+	}
+}
@@ -0,0 +1,126 @@
+package comm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+type pki struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+	serial int64
+}
+
+func newPKI(t *testing.T) *pki {
+	p := &pki{pool: x509.NewCertPool()}
+	cert := p.issue(t, "ca", true)
+	p.ca, p.caKey = cert.Leaf, cert.PrivateKey.(*ecdsa.PrivateKey)
+	p.pool.AddCert(p.ca)
+	return p
+}
+
+// issue creates a certificate for cn signed by the CA, self-signed if ca.
+func (p *pki) issue(t *testing.T, cn string, ca bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	parent, signer := tmpl, key
+	if !ca {
+		parent, signer = p.ca, p.caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestTLS(t *testing.T) {
+	p := newPKI(t)
+	srvCert := p.issue(t, "server", false)
+	good := p.issue(t, "good", false)
+	bad := p.issue(t, "bad", false)
+
+	srv := startServer(t, WithAuth(CommonNames("good")), WithTLS(&tls.Config{
+		Certificates: []tls.Certificate{srvCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    p.pool,
+	}))
+	defer srv.Stop()
+
+	cases := []struct {
+		certs []tls.Certificate
+		ok    bool
+	}{
+		{[]tls.Certificate{good}, true},
+		{[]tls.Certificate{bad}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		conn, err := tls.Dial("tcp", srv.Addr().String(),
+			&tls.Config{RootCAs: p.pool, Certificates: c.certs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 4)
+		_, err = conn.Read(buf)
+		if ok := err == nil; ok != c.ok {
+			t.Errorf("wanted %t, got %t: %v\n", c.ok, ok, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestAuthPlain(t *testing.T) {
+	srv := startServer(t, WithAuth(func(conn net.Conn) error {
+		buf := make([]byte, 6)
+		if _, err := conn.Read(buf); err != nil || string(buf) != "secret" {
+			return ErrUnauthorized
+		}
+		return nil
+	}))
+	defer srv.Stop()
+
+	for _, token := range []string{"secret", "guess!"} {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(token))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 4)
+		_, err = conn.Read(buf)
+		if ok := err == nil; ok != (token == "secret") {
+			t.Errorf("%s: wanted %t, got %t: %v\n", token, token == "secret", ok, err)
+		}
+		conn.Close()
+	}
+}
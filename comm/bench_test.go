@@ -0,0 +1,75 @@
+package comm
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+)
+
+// discardConn discards everything written, reading blocks until closed.
+type discardConn struct {
+	net.Conn // nil, panics if anything else is used
+	once     sync.Once
+	closed   chan struct{}
+}
+
+func newDiscardConn() *discardConn {
+	return &discardConn{closed: make(chan struct{})}
+}
+
+func (c *discardConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *discardConn) Read(b []byte) (int, error) {
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *discardConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *discardConn) RemoteAddr() net.Addr {
+	return pipeAddr{}
+}
+
+func benchmarkBroadcast(b *testing.B, clients int, opts ...Option) {
+	srv := NewServer("127.0.0.1:0", nil, opts...)
+	for i := 0; i < clients; i++ {
+		if err := srv.Attach(newDiscardConn()); err != nil {
+			b.Fatal(err)
+		}
+	}
+	src := bb.New(128)
+	src.Write(make([]byte, 128))
+	src.Flip()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(clients * (frameHeader + 128)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		srv.commData("", src.Rewind())
+	}
+	b.StopTimer()
+	srv.Stop()
+}
+
+func BenchmarkBroadcast1(b *testing.B) {
+	benchmarkBroadcast(b, 1, WithQueue(1024, Block))
+}
+
+func BenchmarkBroadcast64(b *testing.B) {
+	benchmarkBroadcast(b, 64, WithQueue(1024, Block))
+}
+
+func BenchmarkBroadcast64Batch(b *testing.B) {
+	benchmarkBroadcast(b, 64, WithQueue(1024, Block), WithBatch(64))
+}
+
+func BenchmarkBroadcast64Replay(b *testing.B) {
+	benchmarkBroadcast(b, 64, WithQueue(1024, Block), WithReplay(1024))
+}
@@ -0,0 +1,54 @@
+package comm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Buffer is an encoded frame shared by all clients it is broadcast to. It is
+// reference counted and returned to a pool for reuse once every holder
+// released it. Buffers still queued for a closed client are left to the
+// garbage collector.
+type Buffer struct {
+	b    []byte
+	refs int32
+}
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(Buffer) }}
+
+// newBuffer returns a pooled buffer of n bytes holding one reference.
+func newBuffer(n int) *Buffer {
+	buf := bufferPool.Get().(*Buffer)
+	if cap(buf.b) < n {
+		buf.b = make([]byte, n)
+	}
+	buf.b = buf.b[:n]
+	buf.refs = 1
+	return buf
+}
+
+// bufferOf returns a pooled buffer holding a copy of b.
+func bufferOf(b []byte) *Buffer {
+	buf := newBuffer(len(b))
+	copy(buf.b, b)
+	return buf
+}
+
+// Bytes returns the encoded frame, it must not be modified or retained.
+func (buf *Buffer) Bytes() []byte {
+	return buf.b
+}
+
+func (buf *Buffer) retain() *Buffer {
+	atomic.AddInt32(&buf.refs, 1)
+	return buf
+}
+
+func (buf *Buffer) release() {
+	switch refs := atomic.AddInt32(&buf.refs, -1); {
+	case refs == 0:
+		bufferPool.Put(buf)
+	case refs < 0:
+		panic("comm: buffer released too often")
+	}
+}
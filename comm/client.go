@@ -1,40 +1,339 @@
 package comm
 
 import (
+	"bufio"
+	"log/slog"
 	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kenix/gomad/util"
 )
 
 type Client struct {
-	conn  net.Conn
-	bytes uint64
+	conn    net.Conn
+	id      uint64 // unique per server
+	log     *slog.Logger
+	ip      string // remote IP, empty if not an IP connection
+	bytes   uint64
+	msgs    uint64
+	drops   uint64
+	since   time.Time
+	total   *traffic // shared by all clients of a server, may be nil
+	policy  Policy
+	timeout time.Duration
+	stop    <-chan util.Cue // closed when the server stops, aborts blocking offers
+
+	heartbeat    time.Duration // idle time after which a heartbeat is sent
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	done    chan util.Cue
+	once    sync.Once
+	drain   chan util.Cue // closed to send what's queued and stop
+	drained chan util.Cue // closed when Do returns
+	mu      sync.Mutex    // guards topics and err
+	topics  map[string]bool
+	err     error
+
+	replaying bool        // guarded by the server's bmu
+	backlog   []*Buffer   // broadcast while replaying
+	timer     *time.Timer // reused for blocking offers, guarded by the server's omu
+
+	batch   int         // max. frames sent at once
+	pending []*Buffer   // reused by Do for batching
+	iov     net.Buffers // reused by Do for batching
+	bufs    net.Buffers // consumed by writing
 }
 
 func NewClient(conn net.Conn) *Client {
-	return &Client{conn, 0}
+	return &Client{conn: conn, log: defaultLogger.With("remote", addrOf(conn.RemoteAddr())),
+		since: time.Now(), policy: Block, done: make(chan util.Cue),
+		drain: make(chan util.Cue), drained: make(chan util.Cue),
+		topics: make(map[string]bool)}
 }
 
+// Do sends data received from dc.Out to the client until the client is closed
+// or drained. A heartbeat is sent whenever the client was idle for its
+// heartbeat interval. The client is passed to notify if sending fails.
 func (cln *Client) Do(dc DualChan, notify chan<- *Client) {
-	for dat := range dc.Out {
+	defer close(cln.drained)
+	var beat <-chan time.Time
+	idle := func() {}
+	if cln.heartbeat > 0 {
+		t := time.NewTimer(cln.heartbeat)
+		defer t.Stop()
+		beat = t.C
+		idle = func() { t.Reset(cln.heartbeat) }
+	}
+	for {
+		select {
+		case b := <-dc.Out:
+			if !cln.sendQueued(b, dc.Out, notify) {
+				return
+			}
+			idle()
+		case <-beat:
+			if !cln.send(heartbeat, notify) {
+				return
+			}
+			idle()
+		case <-cln.drain:
+			for {
+				select {
+				case b := <-dc.Out:
+					if !cln.sendQueued(b, dc.Out, notify) {
+						return
+					}
+				default:
+					cln.log.Info("drained client")
+					return
+				}
+			}
+		case <-cln.done:
+			cln.log.Debug("done on client")
+			return
+		}
+	}
+}
+
+// sendQueued sends b and releases it. With batching up to batch frames
+// already queued in out are sent along with b in a single vectored write.
+func (cln *Client) sendQueued(b *Buffer, out chan *Buffer, notify chan<- *Client) bool {
+	if cln.batch <= 1 {
+		ok := cln.send(b.b, notify)
+		b.release()
+		return ok
+	}
+	cln.pending = append(cln.pending[:0], b)
+more:
+	for len(cln.pending) < cln.batch {
+		select {
+		case b := <-out:
+			cln.pending = append(cln.pending, b)
+		default:
+			break more
+		}
+	}
+	cln.iov = cln.iov[:0]
+	for _, b := range cln.pending {
+		cln.iov = append(cln.iov, b.b)
+	}
+	cln.bufs = cln.iov
+	ok := cln.write(func() (int64, error) { return cln.bufs.WriteTo(cln.conn) },
+		uint64(len(cln.pending)), notify)
+	for i, b := range cln.pending {
+		b.release()
+		cln.pending[i] = nil
+	}
+	return ok
+}
+
+func (cln *Client) send(dat []byte, notify chan<- *Client) bool {
+	return cln.write(func() (int64, error) {
 		n, err := snd(cln.conn, dat)
-		if err != nil {
-			notify <- cln
-			util.Li.Printf("notify close client from %s\n", cln.conn.RemoteAddr())
+		return int64(n), err
+	}, 1, notify)
+}
+
+// write accounts for msgs messages written by w.
+func (cln *Client) write(w func() (int64, error), msgs uint64, notify chan<- *Client) bool {
+	if cln.writeTimeout > 0 {
+		cln.conn.SetWriteDeadline(time.Now().Add(cln.writeTimeout))
+	}
+	n, err := w()
+	atomic.AddUint64(&cln.bytes, uint64(n))
+	if cln.total != nil {
+		atomic.AddUint64(&cln.total.bytes, uint64(n))
+	}
+	if err != nil {
+		cln.mu.Lock()
+		cln.err = err
+		cln.mu.Unlock()
+		cln.log.Info("failed sending, notify close client", "err", err)
+		notify <- cln
+		return false
+	}
+	atomic.AddUint64(&cln.msgs, msgs)
+	if cln.total != nil {
+		atomic.AddUint64(&cln.total.msgs, msgs)
+	}
+	return true
+}
+
+// failure returns the error sending to the client failed with, if any.
+func (cln *Client) failure() error {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+	return cln.err
+}
+
+// Recv passes lines received from the client to dc.In until the connection
+// is closed, dc.In is closed afterwards. The client is passed to notify if the
+// peer closed the connection or receiving fails.
+func (cln *Client) Recv(dc DualChan, notify chan<- *Client) {
+	defer close(dc.In)
+	scanner := bufio.NewScanner(&deadlineReader{cln.conn, cln.readTimeout})
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		select {
+		case dc.In <- line:
+		case <-cln.done:
 			return
 		}
-		cln.bytes += uint64(n)
 	}
-	util.Li.Printf("done on client from %s\n", cln.conn.RemoteAddr())
+	select {
+	case <-cln.done:
+	default:
+		cln.log.Info("connection closed, notify close client", "err", scanner.Err())
+		notify <- cln
+	}
+}
+
+// Subscribe subscribes the client to topic.
+func (cln *Client) Subscribe(topic string) {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+	cln.topics[topic] = true
+}
+
+// Unsubscribe unsubscribes the client from topic.
+func (cln *Client) Unsubscribe(topic string) {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+	delete(cln.topics, topic)
+}
+
+// Topics returns the topics the client is subscribed to.
+func (cln *Client) Topics() []string {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+	topics := make([]string, 0, len(cln.topics))
+	for topic := range cln.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Subscribed denotes if the client is subscribed to topic.
+func (cln *Client) Subscribed(topic string) bool {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+	return cln.topics[topic]
+}
+
+// offer queues b into out according to this client's policy, taking a
+// reference on b while queued. It returns false if the client is too slow and
+// should be disconnected. Data offered to a closed client is discarded, as is
+// data blocking once the server stops.
+func (cln *Client) offer(out chan *Buffer, b *Buffer) bool {
+	b.retain()
+	switch cln.policy {
+	case DropOldest:
+		for {
+			select {
+			case out <- b:
+				return true
+			case <-cln.done:
+				b.release()
+				return true
+			default:
+			}
+			select {
+			case old := <-out:
+				old.release()
+				cln.drop()
+			default:
+			}
+		}
+	case DropNewest:
+		select {
+		case out <- b:
+		default:
+			b.release()
+			cln.drop()
+		}
+	case Disconnect:
+		select {
+		case out <- b:
+		default:
+			b.release()
+			cln.drop()
+			return false
+		}
+	default:
+		if cln.timeout <= 0 {
+			select {
+			case out <- b:
+			case <-cln.done:
+				b.release()
+			case <-cln.stop:
+				b.release()
+			}
+			return true
+		}
+		if cln.timer == nil {
+			cln.timer = time.NewTimer(cln.timeout)
+		} else {
+			cln.timer.Reset(cln.timeout)
+		}
+		defer cln.timer.Stop()
+		select {
+		case out <- b:
+		case <-cln.done:
+			b.release()
+		case <-cln.stop:
+			b.release()
+		case <-cln.timer.C:
+			b.release()
+			cln.drop()
+		}
+	}
+	return true
 }
 
+func (cln *Client) drop() {
+	atomic.AddUint64(&cln.drops, 1)
+}
+
+// Close closes the client's connection and stops Do, it is safe to be called
+// more than once.
 func (cln *Client) Close() {
-	util.Li.Printf("close client from %s\n", cln.conn.RemoteAddr())
-	cln.conn.Close()
+	cln.once.Do(func() {
+		cln.log.Info("close client")
+		close(cln.done)
+		cln.conn.Close()
+	})
 }
 
 func (cln *Client) BytesTransferred() uint64 {
-	return cln.bytes
+	return atomic.LoadUint64(&cln.bytes)
+}
+
+// MessagesTransferred returns the number of broadcast data sent to the client.
+func (cln *Client) MessagesTransferred() uint64 {
+	return atomic.LoadUint64(&cln.msgs)
+}
+
+// Drops returns the number of broadcast data dropped for this client.
+func (cln *Client) Drops() uint64 {
+	return atomic.LoadUint64(&cln.drops)
+}
+
+// deadlineReader fails reading if no data arrives within timeout, if set.
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *deadlineReader) Read(b []byte) (int, error) {
+	if r.timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	}
+	return r.conn.Read(b)
 }
 
 func snd(conn net.Conn, dat []byte) (int, error) {
@@ -42,11 +341,9 @@ func snd(conn net.Conn, dat []byte) (int, error) {
 	for sent < len(dat) {
 		n, err := conn.Write(dat[sent:])
 		if err != nil {
-			util.Le.Printf("failed sending data %s\n", err)
 			return sent, err
 		}
 		sent += n
 	}
-	// util.Lt.Printf("sent %d byte(s) to %s\n", sent, conn.RemoteAddr())
 	return sent, nil
 }
@@ -0,0 +1,68 @@
+package comm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOffer(t *testing.T) {
+	cases := []struct {
+		policy Policy
+		ok     bool
+		queued []string
+		drops  uint64
+	}{
+		{DropOldest, true, []string{"b", "c"}, 1},
+		{DropNewest, true, []string{"a", "b"}, 1},
+		{Disconnect, false, []string{"a", "b"}, 1},
+		{Block, true, []string{"a", "b"}, 1},
+	}
+
+	for _, c := range cases {
+		cln := &Client{policy: c.policy, timeout: time.Millisecond}
+		out := make(chan *Buffer, 2)
+		bufs := []*Buffer{bufferOf([]byte("a")), bufferOf([]byte("b")), bufferOf([]byte("c"))}
+		cln.offer(out, bufs[0])
+		cln.offer(out, bufs[1])
+		if ok := cln.offer(out, bufs[2]); ok != c.ok {
+			t.Errorf("%s: wanted %t, got %t\n", c.policy, c.ok, ok)
+		}
+		close(out)
+		var got []string
+		for b := range out {
+			got = append(got, string(b.Bytes()))
+			if b.refs != 2 {
+				t.Errorf("%s: wanted 2 references on queued %s, got %d\n", c.policy, b.b, b.refs)
+			}
+		}
+		var refs int32
+		for _, b := range bufs {
+			refs += b.refs
+		}
+		if want := int32(len(bufs) + len(got)); refs != want {
+			t.Errorf("%s: wanted %d reference(s), got %d\n", c.policy, want, refs)
+		}
+		if len(got) != len(c.queued) || got[0] != c.queued[0] || got[1] != c.queued[1] {
+			t.Errorf("%s: wanted %v, got %v\n", c.policy, c.queued, got)
+		}
+		if cln.Drops() != c.drops {
+			t.Errorf("%s: wanted %d drop(s), got %d\n", c.policy, c.drops, cln.Drops())
+		}
+	}
+}
+
+func TestOfferBlock(t *testing.T) {
+	cln := &Client{policy: Block, timeout: time.Second}
+	out := make(chan *Buffer, 1)
+	cln.offer(out, bufferOf([]byte("a")))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-out
+	}()
+	if !cln.offer(out, bufferOf([]byte("b"))) || cln.Drops() != 0 {
+		t.Errorf("wanted block until queue space, got %d drop(s)\n", cln.Drops())
+	}
+	if b := <-out; string(b.Bytes()) != "b" {
+		t.Errorf("wanted b, got %s\n", b.Bytes())
+	}
+}
@@ -0,0 +1,133 @@
+package comm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Commands sent by clients, one per line, e.g. "SUB EURUSD\n".
+const (
+	CmdSubscribe   = "SUB"
+	CmdUnsubscribe = "UNSUB"
+	CmdReplay      = "REPLAY" // REPLAY <seq>, replays frames from seq on
+	CmdPing        = "PING"   // keeps the connection alive
+	// CmdRequest wraps any command to be answered by a KindResponse frame
+	// carrying the request's id, e.g. "REQ 7 STATUS\n".
+	CmdRequest  = "REQ"
+	CmdStatus   = "STATUS"   // answers the server's status line
+	CmdStats    = "STATS"    // answers the server's statistics as JSON
+	CmdTopics   = "TOPICS"   // answers the client's topics, one per line
+	CmdSnapshot = "SNAPSHOT" // SNAPSHOT [topic], answers the latest data
+)
+
+// Response status, the topic of a KindResponse frame.
+const (
+	StatusOK    = "OK"
+	StatusError = "ERR" // the data is the error message
+)
+
+var errCommand = errors.New("invalid command")
+
+// parseCommand splits a command line into its upper cased verb and arguments.
+func parseCommand(line []byte) (string, []string) {
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(fields[0]), fields[1:]
+}
+
+// handle processes the commands received from client c until its inbound
+// channel is closed. Requests are answered on dc.Out in line with the data
+// broadcast.
+func (srv *Server) handle(c *Client, dc DualChan) {
+	for line := range dc.In {
+		verb, args := parseCommand(line)
+		if verb != CmdRequest {
+			if _, err := srv.exec(c, dc, verb, args); err != nil {
+				c.log.Warn("failed command", "line", line, "err", err)
+			}
+			continue
+		}
+		if len(args) < 1 {
+			c.log.Warn("invalid command", "line", line)
+			continue
+		}
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			c.log.Warn("invalid command", "line", line)
+			continue
+		}
+		resp := Frame{Kind: KindResponse, Seq: id, Topic: StatusOK}
+		if len(args) < 2 {
+			resp.Topic, resp.Data = StatusError, []byte(errCommand.Error())
+		} else if resp.Data, err = srv.exec(c, dc, strings.ToUpper(args[1]), args[2:]); err != nil {
+			resp.Topic, resp.Data = StatusError, []byte(err.Error())
+		}
+		select {
+		case dc.Out <- bufferOf(resp.Bytes()):
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// exec executes a command of client c, returns the answer to a request.
+func (srv *Server) exec(c *Client, dc DualChan, verb string, args []string) ([]byte, error) {
+	switch verb {
+	case "", CmdPing:
+	case CmdSubscribe:
+		for _, topic := range args {
+			c.Subscribe(topic)
+		}
+	case CmdUnsubscribe:
+		for _, topic := range args {
+			c.Unsubscribe(topic)
+		}
+	case CmdReplay:
+		if len(args) != 1 {
+			return nil, errCommand
+		}
+		from, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return nil, errCommand
+		}
+		srv.replayTo(c, dc, from)
+	case CmdStatus:
+		return []byte(srv.Status()), nil
+	case CmdStats:
+		return json.Marshal(srv.Stats())
+	case CmdTopics:
+		return []byte(strings.Join(c.Topics(), "\n")), nil
+	case CmdSnapshot:
+		if len(args) > 1 {
+			return nil, errCommand
+		}
+		topic := ""
+		if len(args) == 1 {
+			topic = args[0]
+		}
+		return srv.snapshot(topic)
+	default:
+		return nil, fmt.Errorf("unknown command %s", verb)
+	}
+	return nil, nil
+}
+
+// snapshot returns a copy of the latest data broadcast for topic.
+func (srv *Server) snapshot(topic string) ([]byte, error) {
+	srv.bmu.Lock()
+	defer srv.bmu.Unlock()
+	b := srv.latest[topic]
+	if b == nil {
+		return nil, fmt.Errorf("no data for topic %q", topic)
+	}
+	f, _, err := DecodeFrame(b.b)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), f.Data...), nil
+}
@@ -0,0 +1,81 @@
+package comm
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRequest(t *testing.T) {
+	srv := startServer(t)
+	defer srv.Stop()
+	s := NewSubscriber(srv.Addr().String())
+	s.Retries = 1
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Next(); err != nil { // data for the snapshot
+		t.Fatal(err)
+	}
+	go func() { // keeps the stream flowing and receives the responses
+		for {
+			if _, err := s.Next(); err != nil {
+				return
+			}
+		}
+	}()
+
+	cases := []struct {
+		cmd  string
+		want string
+		err  bool
+	}{
+		{"ping", "", false},
+		{"STATUS", "1 client(s)", false},
+		{"SUB a b", "", false},
+		{"TOPICS", "a\nb", false},
+		{"SNAPSHOT", "tick", false},
+		{"SNAPSHOT a", "", true},
+		{"REPLAY x", "", true},
+		{"FOO", "", true},
+	}
+	for _, c := range cases {
+		got, err := s.Request(c.cmd, time.Second)
+		var re RemoteError
+		if c.err != errors.As(err, &re) {
+			t.Errorf("%s: wanted remote error %t, got %v\n", c.cmd, c.err, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: wanted %q, got %q\n", c.cmd, c.want, got)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	s := NewSubscriber(l.Addr().String())
+	if _, err := s.Request(CmdStatus, time.Millisecond); err != ErrClosed {
+		t.Errorf("wanted %v, got %v\n", ErrClosed, err)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Request(CmdStatus, 10*time.Millisecond); err != ErrTimeout {
+		t.Errorf("wanted %v, got %v\n", ErrTimeout, err)
+	}
+}
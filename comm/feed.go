@@ -0,0 +1,125 @@
+package comm
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+	sp "github.com/kenix/gomad/supplier"
+	"github.com/kenix/gomad/util"
+)
+
+// feed is a supplier whose data is broadcast under a topic. The feed of the
+// server's default supplier has the empty topic.
+type feed struct {
+	topic    string
+	supplier sp.Source
+	push     <-chan util.Cue
+	notifier sp.Notifier
+	source   bool // supplier reports errors and its end itself
+	errors   int  // consecutive
+}
+
+func newFeed(topic string, supplier sp.Supplier) *feed {
+	_, source := supplier.(sp.Source)
+	n, _ := supplier.(sp.Notifier)
+	return &feed{topic: topic, supplier: sp.AsSource(supplier), notifier: n, source: source}
+}
+
+func (srv *Server) serve(f *feed) {
+	defer srv.wgGroup.Done()
+	buf := bb.New(srv.bufferSize)
+	push, tick := f.push, (<-chan time.Time)(nil)
+	if f.notifier != nil && push == nil {
+		push = f.notifier.Notify() // only now, pushing may start on it
+	}
+	if push == nil {
+		ticker := time.NewTicker(srv.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	srv.log.Info("started serving", "topic", f.topic)
+	for {
+		select {
+		case <-srv.done:
+			srv.log.Info("stopped serving", "topic", f.topic)
+			return
+		case <-tick:
+			if srv.ended(f, srv.supply(f, buf)) {
+				return
+			}
+		case _, ok := <-push:
+			var err error = io.EOF
+			if ok || f.source { // a source tells why it stopped pushing
+				err = srv.supply(f, buf)
+			}
+			if !ok && err == nil {
+				srv.log.Info("supplier stopped pushing", "topic", f.topic)
+				err = io.EOF
+			}
+			if !ok && err != io.EOF { // no more cues, nothing to retry
+				srv.log.Error("supplier failed", "topic", f.topic, "err", err)
+				srv.end()
+				return
+			}
+			if srv.ended(f, err) {
+				return
+			}
+		}
+	}
+}
+
+// supply broadcasts the data supplied by the feed, returns the error
+// supplying failed with.
+func (srv *Server) supply(f *feed, buf bb.ByteBuffer) error {
+	_, err := f.supplier.Supply(buf)
+	if buf.Flip().HasRemaining() {
+		atomic.AddUint64(&srv.broadcasts, 1)
+		atomic.AddUint64(&srv.supplied, uint64(buf.Remaining()))
+		srv.commData(f.topic, buf)
+	}
+	buf.Clear()
+	if err != nil && err != io.EOF {
+		atomic.AddUint64(&srv.supplierErrors, 1)
+		srv.log.Warn("failed supplying", "topic", f.topic, "err", err)
+	}
+	return err
+}
+
+// ended denotes if the feed ends because its supplier is exhausted, failed for
+// good or failed too often in a row.
+func (srv *Server) ended(f *feed, err error) bool {
+	switch {
+	case err == nil:
+		f.errors = 0
+		return false
+	case err == io.EOF:
+		srv.log.Info("supplier exhausted", "topic", f.topic)
+	default:
+		if fl, ok := f.supplier.(sp.Failer); ok && fl.Err() != nil {
+			srv.log.Error("supplier failed", "topic", f.topic, "err", fl.Err())
+			break
+		}
+		if f.errors++; srv.maxErrors <= 0 || f.errors < srv.maxErrors {
+			return false
+		}
+		srv.log.Error("supplier failed too often", "topic", f.topic, "errors", f.errors)
+	}
+	srv.end()
+	return true
+}
+
+// end denotes that a feed ended, the server is exhausted after its last feed
+// ended.
+func (srv *Server) end() {
+	if atomic.AddInt32(&srv.live, -1) == 0 {
+		close(srv.exhausted)
+	}
+}
+
+// Exhausted returns a channel closed once the suppliers of all topics are
+// exhausted or failed too often, i.e. no more data will be broadcast.
+func (srv *Server) Exhausted() <-chan util.Cue {
+	return srv.exhausted
+}
@@ -0,0 +1,147 @@
+package comm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+)
+
+// Frame kinds.
+const (
+	KindData byte = iota + 1
+	// KindReplay marks the start of replayed frames, its sequence number is
+	// the one of the first frame replayed, 0 if none. Frames received before
+	// it are broadcast prior to the replay.
+	KindReplay
+	// KindHeartbeat is sent to idle clients, it carries no data.
+	KindHeartbeat
+	// KindResponse answers a request, its sequence number is the request's
+	// id, its topic the status and its data the answer.
+	KindResponse
+)
+
+// frameHeader is the size of a frame without topic and data: kind, sequence
+// number, topic length and data length.
+const frameHeader = 1 + 8 + 1 + 4
+
+// MaxTopicLength is the maximum length of a frame's topic.
+const MaxTopicLength = math.MaxUint8
+
+// MaxDataLength is the maximum length of a frame's data read by ReadFrame, so
+// that a corrupt stream can't make readers allocate gigabytes.
+const MaxDataLength = 64 << 20
+
+var ErrFrame = errors.New("comm: malformed frame")
+
+var heartbeat = (&Frame{Kind: KindHeartbeat}).Bytes()
+
+// Frame is the unit sent on the wire, all integers in network byte order:
+//
+//	kind(1) seq(8) topic length(1) topic data length(4) data
+type Frame struct {
+	Kind  byte
+	Seq   uint64
+	Topic string
+	Data  []byte
+}
+
+func (f *Frame) String() string {
+	return fmt.Sprintf("%d;%d;%s;%d", f.Kind, f.Seq, f.Topic, len(f.Data))
+}
+
+// Len returns the encoded length of the frame.
+func (f *Frame) Len() int {
+	return frameHeader + len(f.Topic) + len(f.Data)
+}
+
+// Encode writes the frame into buf, panics if buf cannot hold it.
+func (f *Frame) Encode(buf bb.ByteBuffer) {
+	if len(f.Topic) > MaxTopicLength {
+		panic(ErrFrame)
+	}
+	o := buf.Order()
+	defer buf.OrderTo(o)
+	buf.OrderTo(binary.BigEndian).PutAll(f.Kind, f.Seq, byte(len(f.Topic)),
+		[]byte(f.Topic), uint32(len(f.Data)), f.Data)
+}
+
+// putHeader encodes the header of a frame with topic and n bytes of data into
+// b, returns the header's length.
+func putHeader(b []byte, kind byte, seq uint64, topic string, n int) int {
+	b[0] = kind
+	binary.BigEndian.PutUint64(b[1:], seq)
+	b[9] = byte(len(topic))
+	copy(b[10:], topic)
+	binary.BigEndian.PutUint32(b[10+len(topic):], uint32(n))
+	return frameHeader + len(topic)
+}
+
+// Bytes returns the encoded frame.
+func (f *Frame) Bytes() []byte {
+	buf := bb.New(f.Len())
+	f.Encode(buf)
+	return buf.Flip().GetN(buf.Remaining())
+}
+
+// DecodeFrame reads one frame from b, returns the frame and the number of
+// bytes consumed. ErrFrame is returned if b doesn't hold a complete frame.
+func DecodeFrame(b []byte) (Frame, int, error) {
+	var f Frame
+	if len(b) < frameHeader {
+		return f, 0, ErrFrame
+	}
+	buf := bb.Wrap(b).OrderTo(binary.BigEndian)
+	f.Kind = buf.Get()
+	f.Seq = buf.GetUint64()
+	tl := int(buf.Get())
+	if buf.Remaining() < tl+4 {
+		return f, 0, ErrFrame
+	}
+	f.Topic = string(buf.GetN(tl))
+	dl := int(buf.GetUint32())
+	if buf.Remaining() < dl {
+		return f, 0, ErrFrame
+	}
+	f.Data = buf.GetN(dl)
+	return f, buf.Position(), nil
+}
+
+// ReadFrame reads the next frame from r. ErrFrame is returned for data longer
+// than MaxDataLength.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var f Frame
+	hdr := make([]byte, frameHeader-4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return f, err
+	}
+	buf := bb.Wrap(hdr).OrderTo(binary.BigEndian)
+	f.Kind = buf.Get()
+	f.Seq = buf.GetUint64()
+	rest := make([]byte, int(buf.Get())+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return f, unexpected(err)
+	}
+	buf = bb.Wrap(rest).OrderTo(binary.BigEndian)
+	f.Topic = string(buf.GetN(len(rest) - 4))
+	dl := buf.GetUint32()
+	if dl > MaxDataLength {
+		return f, ErrFrame
+	}
+	f.Data = make([]byte, dl)
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		return f, unexpected(err)
+	}
+	return f, nil
+}
+
+// unexpected turns io.EOF into io.ErrUnexpectedEOF for incomplete frames.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package comm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	cases := []Frame{
+		{KindData, 1, "", nil},
+		{KindData, 1 << 40, "EURUSD", []byte("tick")},
+	}
+	for _, c := range cases {
+		b := c.Bytes()
+		if len(b) != c.Len() {
+			t.Errorf("wanted %d, got %d\n", c.Len(), len(b))
+		}
+		f, n, err := DecodeFrame(append(b, 0xFF))
+		if err != nil || n != len(b) {
+			t.Fatalf("wanted %d byte(s), got %d: %v\n", len(b), n, err)
+		}
+		if f.String() != c.String() || string(f.Data) != string(c.Data) {
+			t.Errorf("wanted %s, got %s\n", &c, &f)
+		}
+		if _, _, err := DecodeFrame(b[:len(b)-1]); err != ErrFrame {
+			t.Errorf("wanted %v, got %v\n", ErrFrame, err)
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	f := Frame{KindData, 1, "EURUSD", []byte("tick")}
+	b := f.Bytes()
+	got, err := ReadFrame(bytes.NewReader(b))
+	if err != nil || got.String() != f.String() || string(got.Data) != "tick" {
+		t.Errorf("wanted %s, got %s: %v\n", &f, &got, err)
+	}
+	binary.BigEndian.PutUint32(b[frameHeader-4+len(f.Topic):], MaxDataLength+1)
+	if _, err := ReadFrame(bytes.NewReader(b)); err != ErrFrame {
+		t.Errorf("wanted %v, got %v\n", ErrFrame, err)
+	}
+}
@@ -0,0 +1,147 @@
+package comm
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Reasons for rejecting connections.
+const (
+	RejectDenied    = "denied"
+	RejectRate      = "rate"
+	RejectMaxConns  = "max-conns"
+	RejectMaxPerIP  = "max-per-ip"
+	RejectHandshake = "handshake"
+	RejectAuth      = "auth"
+)
+
+var (
+	ErrLimit    = errors.New("comm: connection limit reached")
+	ErrRejected = errors.New("comm: connection rejected")
+)
+
+// tokenBucket allows events at rate per second on average with bursts.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst),
+		last: time.Now()}
+}
+
+func (tb *tokenBucket) allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	now := time.Now()
+	tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+func ipOf(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+	return ""
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (srv *Server) parseCIDRs() (err error) {
+	if srv.allowNets, err = parseCIDRs(srv.allow); err != nil {
+		return err
+	}
+	srv.denyNets, err = parseCIDRs(srv.deny)
+	return err
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// screen returns the reason to reject conn right after accepting it, empty if
+// it passes the CIDR lists and the accept rate.
+func (srv *Server) screen(conn net.Conn) string {
+	if ip := net.ParseIP(ipOf(conn.RemoteAddr())); ip != nil {
+		if contains(srv.denyNets, ip) ||
+			len(srv.allowNets) > 0 && !contains(srv.allowNets, ip) {
+			return RejectDenied
+		}
+	}
+	if srv.acceptRate != nil && !srv.acceptRate.allow() {
+		return RejectRate
+	}
+	return ""
+}
+
+// overLimitLocked returns the reason to reject another client from ip, empty
+// if within limits.
+func (srv *Server) overLimitLocked(ip string) string {
+	if srv.maxConns > 0 && len(srv.clients)+srv.reserved >= srv.maxConns {
+		return RejectMaxConns
+	}
+	if srv.maxPerIP > 0 && ip != "" && srv.perIP[ip] >= srv.maxPerIP {
+		return RejectMaxPerIP
+	}
+	return ""
+}
+
+func (srv *Server) reject(conn net.Conn, reason string, err error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.rejectLocked(conn, reason, err)
+}
+
+func (srv *Server) rejectLocked(conn net.Conn, reason string, err error) {
+	srv.rejected[reason]++
+	if err != nil {
+		srv.log.Warn("rejected connection", "remote", addrOf(conn.RemoteAddr()), "reason", reason, "err", err)
+	} else {
+		srv.log.Warn("rejected connection", "remote", addrOf(conn.RemoteAddr()), "reason", reason)
+	}
+	conn.Close()
+}
+
+// Rejected returns the number of connections rejected per reason.
+func (srv *Server) Rejected() map[string]uint64 {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	rejected := make(map[string]uint64, len(srv.rejected))
+	for reason, n := range srv.rejected {
+		rejected[reason] = n
+	}
+	return rejected
+}
@@ -0,0 +1,93 @@
+package comm
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// dialRead connects to srv and reports if a frame is received, the connection
+// is returned open.
+func dialRead(t *testing.T, srv *Server) (net.Conn, bool) {
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = ReadFrame(conn)
+	return conn, err == nil
+}
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		opts   []Option
+		oks    []bool
+		reason string
+	}{
+		{[]Option{WithMaxConns(2)}, []bool{true, true, false}, RejectMaxConns},
+		{[]Option{WithMaxConnsPerIP(1)}, []bool{true, false}, RejectMaxPerIP},
+		{[]Option{WithAcceptRate(0.001, 2)}, []bool{true, true, false}, RejectRate},
+		{[]Option{WithDeny("127.0.0.0/8")}, []bool{false}, RejectDenied},
+		{[]Option{WithAllow("10.0.0.0/8")}, []bool{false}, RejectDenied},
+		{[]Option{WithAllow("127.0.0.1/32")}, []bool{true}, ""},
+	}
+
+	for _, c := range cases {
+		srv := startServer(t, c.opts...)
+		for i, want := range c.oks {
+			conn, ok := dialRead(t, srv)
+			defer conn.Close()
+			if ok != want {
+				t.Errorf("%s #%d: wanted %t, got %t\n", c.reason, i, want, ok)
+			}
+		}
+		if rejected := srv.Rejected(); c.reason != "" && rejected[c.reason] != 1 {
+			t.Errorf("wanted 1 %s rejection, got %v\n", c.reason, rejected)
+		}
+		srv.Stop()
+	}
+}
+
+func TestLimitsHandshaking(t *testing.T) {
+	srv := startServer(t, WithMaxConns(1), WithAuth(func(conn net.Conn) error {
+		buf := make([]byte, 6)
+		if _, err := conn.Read(buf); err != nil || string(buf) != "secret" {
+			return ErrUnauthorized
+		}
+		return nil
+	}))
+	defer srv.Stop()
+
+	pending, err := net.Dial("tcp", srv.Addr().String()) // holds the only slot
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, ok := dialRead(t, srv) // accepted after the pending one
+	conn.Close()
+	if got := srv.Rejected()[RejectMaxConns]; ok || got != 1 {
+		t.Errorf("wanted 1 %s rejection, got %t and %v\n", RejectMaxConns, ok, srv.Rejected())
+	}
+
+	pending.Close() // fails authenticating, releasing the slot
+	for srv.Rejected()[RejectAuth] == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	conn, err = net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("secret"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ReadFrame(conn); err != nil {
+		t.Errorf("wanted frame, got %v\n", err)
+	}
+}
+
+func TestBadCIDR(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", nil, WithDeny("10.0.0.0"))
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Error("wanted error for invalid CIDR")
+	}
+}
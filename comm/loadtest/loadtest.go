@@ -0,0 +1,182 @@
+// Package loadtest measures a comm.Server on loopback: a synthetic supplier
+// broadcasts time stamped data as fast as or at the rate configured to a
+// number of simulated clients, some of which may read slowly.
+package loadtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/comm"
+	"github.com/kenix/gomad/util"
+)
+
+// registerTimeout limits waiting for the server to register all clients.
+const registerTimeout = 5 * time.Second
+
+// Config describes a load test.
+type Config struct {
+	Messages  int           // data broadcast in total
+	Payload   int           // bytes per data, at least 8 for the time stamp
+	Rate      float64       // data broadcast per second, 0 as fast as possible
+	Clients   int           // clients reading as fast as possible
+	Slow      int           // clients pausing SlowDelay per frame read
+	SlowDelay time.Duration // pause of slow clients per frame
+	Drain     time.Duration // time granted to send queued data after the last broadcast
+	Options   []comm.Option // server options, e.g. queue size and policy
+}
+
+// Report summarizes a load test.
+type Report struct {
+	Sent     int           // data broadcast
+	Received uint64        // frames received by all clients
+	Drops    uint64        // frames dropped by the server
+	Elapsed  time.Duration // from the first broadcast until all clients stopped reading
+	P50      time.Duration // latency percentiles from supplying to receiving
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// Throughput returns the frames received per second.
+func (r Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Received) / r.Elapsed.Seconds()
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("sent %d, received %d, dropped %d in %s, %.0f frame(s)/s, "+
+		"latency p50 %s p90 %s p99 %s max %s", r.Sent, r.Received, r.Drops,
+		r.Elapsed.Round(time.Millisecond), r.Throughput(), r.P50, r.P90, r.P99, r.Max)
+}
+
+// Run runs the load test described by cfg. It fails if the server rejects
+// clients or does not register all of them in time.
+func Run(cfg Config) (Report, error) {
+	if cfg.Payload < 8 {
+		cfg.Payload = 8
+	}
+	if cfg.Drain <= 0 {
+		cfg.Drain = time.Second
+	}
+	gen := &synthetic{payload: cfg.Payload, notify: make(chan util.Cue)}
+	opts := append([]comm.Option{comm.WithBufferSize(cfg.Payload)}, cfg.Options...)
+	srv := comm.NewServer("127.0.0.1:0", gen, opts...)
+	if err := srv.Start(); err != nil {
+		return Report{}, err
+	}
+	defer srv.Stop()
+
+	n := cfg.Clients + cfg.Slow
+	readers := make([]*reader, n)
+	var wg sync.WaitGroup
+	for i := range readers {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		if err != nil {
+			return Report{}, err
+		}
+		readers[i] = &reader{conn: conn, lats: make([]time.Duration, 0, cfg.Messages)}
+		if i >= cfg.Clients {
+			readers[i].delay = cfg.SlowDelay
+		}
+		wg.Add(1)
+		go readers[i].run(&wg)
+	}
+	deadline := time.Now().Add(registerTimeout)
+	for len(srv.Stats().Clients) < n { // wait until all are registered
+		if rejected := srv.Rejected(); len(rejected) > 0 || time.Now().After(deadline) {
+			return Report{}, fmt.Errorf("loadtest: %d of %d client(s) registered, rejected %v",
+				len(srv.Stats().Clients), n, rejected)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	gen.run(cfg.Messages, cfg.Rate)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Drain)
+	defer cancel()
+	srv.Shutdown(ctx)
+	wg.Wait()
+
+	rep := Report{Sent: cfg.Messages, Drops: srv.Drops(), Elapsed: time.Since(start)}
+	var lats []time.Duration
+	for _, r := range readers {
+		rep.Received += r.frames
+		lats = append(lats, r.lats...)
+	}
+	if len(lats) > 0 {
+		sort.Slice(lats, func(i, j int) bool { return lats[i] < lats[j] })
+		pct := func(p int) time.Duration { return lats[(len(lats)-1)*p/100] }
+		rep.P50, rep.P90, rep.P99, rep.Max = pct(50), pct(90), pct(99), lats[len(lats)-1]
+	}
+	return rep, nil
+}
+
+// synthetic is a push supplier of data stamped with the time supplied.
+type synthetic struct {
+	payload int
+	notify  chan util.Cue
+}
+
+// run pushes n data at rate per second, as fast as taken if rate is 0.
+func (s *synthetic) run(n int, rate float64) {
+	defer close(s.notify)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if rate > 0 {
+			if d := time.Until(start.Add(time.Duration(float64(i) / rate * float64(time.Second)))); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		s.notify <- util.Cue{}
+	}
+}
+
+func (s *synthetic) Get(buf bb.ByteBuffer) {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()))
+	buf.PutN(ts[:])
+	buf.PositionTo(buf.Position() + s.payload - len(ts))
+}
+
+func (s *synthetic) Notify() <-chan util.Cue {
+	return s.notify
+}
+
+// reader is a simulated client recording the latency of every frame.
+type reader struct {
+	conn   net.Conn
+	delay  time.Duration
+	frames uint64
+	lats   []time.Duration
+}
+
+func (r *reader) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer r.conn.Close()
+	rd := bufio.NewReader(r.conn)
+	for {
+		f, err := comm.ReadFrame(rd)
+		if err != nil {
+			return
+		}
+		if f.Kind != comm.KindData || len(f.Data) < 8 {
+			continue
+		}
+		ts := int64(binary.BigEndian.Uint64(f.Data))
+		r.lats = append(r.lats, time.Duration(time.Now().UnixNano()-ts))
+		r.frames++
+		if r.delay > 0 {
+			time.Sleep(r.delay)
+		}
+	}
+}
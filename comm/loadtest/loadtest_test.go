@@ -0,0 +1,90 @@
+package loadtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/kenix/gomad/comm"
+	"github.com/kenix/gomad/util"
+)
+
+func init() {
+	util.InitLoggers(ioutil.Discard)
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		cfg   Config
+		drops bool
+	}{
+		{Config{Messages: 1000, Payload: 64, Clients: 4,
+			Options: []comm.Option{comm.WithQueue(1000, comm.Block)}}, false},
+		{Config{Messages: 2000, Payload: 4096, Clients: 2, Slow: 2, SlowDelay: 200 * time.Microsecond,
+			Drain:   10 * time.Millisecond,
+			Options: []comm.Option{comm.WithQueue(16, comm.DropOldest)}}, true},
+	}
+	for _, c := range cases {
+		rep, err := Run(c.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all := uint64(c.cfg.Messages * (c.cfg.Clients + c.cfg.Slow))
+		if (rep.Drops > 0) != c.drops {
+			t.Errorf("wanted drops %t, got %s\n", c.drops, rep)
+		}
+		if !c.drops && rep.Received != all {
+			t.Errorf("wanted %d received, got %s\n", all, rep)
+		}
+		if rep.Max < rep.P50 || rep.P50 <= 0 {
+			t.Errorf("wanted latencies, got %s\n", rep)
+		}
+	}
+}
+
+func TestRunRejected(t *testing.T) {
+	_, err := Run(Config{Messages: 10, Clients: 2,
+		Options: []comm.Option{comm.WithMaxConns(1)}})
+	if err == nil {
+		t.Error("wanted error, got nil")
+	}
+}
+
+func benchmarkLoad(b *testing.B, cfg Config) {
+	cfg.Messages, cfg.Payload = b.N, 128
+	b.SetBytes(int64(cfg.Payload * (cfg.Clients + cfg.Slow)))
+	b.ResetTimer()
+	rep, err := Run(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(rep.Throughput(), "frames/s")
+	b.ReportMetric(float64(rep.P50.Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(rep.P99.Nanoseconds()), "p99-ns")
+	b.ReportMetric(float64(rep.Drops), "drops")
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, clients := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			benchmarkLoad(b, Config{Clients: clients,
+				Options: []comm.Option{comm.WithQueue(4096, comm.Block)}})
+		})
+	}
+}
+
+func BenchmarkLoadSlow(b *testing.B) {
+	for _, policy := range []comm.Policy{comm.DropOldest, comm.DropNewest} {
+		b.Run(policy.String(), func(b *testing.B) {
+			benchmarkLoad(b, Config{Clients: 15, Slow: 1, SlowDelay: 100 * time.Microsecond,
+				Drain:   10 * time.Millisecond,
+				Options: []comm.Option{comm.WithQueue(256, policy)}})
+		})
+	}
+}
+
+func BenchmarkLoadBatch(b *testing.B) {
+	benchmarkLoad(b, Config{Clients: 64,
+		Options: []comm.Option{comm.WithQueue(4096, comm.Block), comm.WithBatch(64)}})
+}
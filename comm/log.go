@@ -0,0 +1,102 @@
+package comm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/kenix/gomad/util"
+)
+
+// defaultLogger logs to the util package loggers, it is used unless a logger
+// is given, e.g. by WithLogger.
+var defaultLogger = slog.New(&utilHandler{})
+
+// utilHandler is a slog.Handler writing records to the util logger of their
+// level as message followed by key=value pairs. The util loggers are looked
+// up per record, so that util.InitLoggers takes effect at any time.
+type utilHandler struct {
+	attrs  string // preformatted attributes
+	prefix string // of keys, groups joined by dots
+}
+
+func (h *utilHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *utilHandler) Handle(_ context.Context, r slog.Record) error {
+	// 4 skips Handle and slog's logging methods up to their caller
+	return utilLogger(r.Level).Output(4, h.format(r))
+}
+
+func (h *utilHandler) format(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.prefix, a)
+		return true
+	})
+	return b.String()
+}
+
+func (h *utilHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&b, h.prefix, a)
+	}
+	return &utilHandler{attrs: b.String(), prefix: h.prefix}
+}
+
+func (h *utilHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &utilHandler{attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+func utilLogger(level slog.Level) *log.Logger {
+	switch {
+	case level < slog.LevelInfo:
+		return util.Lt
+	case level < slog.LevelWarn:
+		return util.Li
+	case level < slog.LevelError:
+		return util.Lw
+	}
+	return util.Le
+}
+
+func appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(b, prefix, ga)
+		}
+		return
+	}
+	s := a.Value.String()
+	if strings.ContainsAny(s, " \t\n\"=") || s == "" {
+		s = strconv.Quote(s)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, s)
+}
+
+// addrOf returns a as string for logging, empty if a is nil.
+func addrOf(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
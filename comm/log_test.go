@@ -0,0 +1,67 @@
+package comm
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kenix/gomad/util"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestUtilHandler(t *testing.T) {
+	h := (&utilHandler{}).WithAttrs([]slog.Attr{slog.String("remote", "a b")}).WithGroup("g")
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, "hello", 0)
+	r.Add("n", 1, slog.Group("h", "s", ""))
+	want := `hello remote="a b" g.n=1 g.h.s=""`
+	if got := h.(*utilHandler).format(r); got != want {
+		t.Errorf("wanted %s, got %s\n", want, got)
+	}
+	if got := utilLogger(slog.LevelWarn); got != util.Lw {
+		t.Errorf("wanted warning logger, got %s\n", got.Prefix())
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf syncBuffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	srv := startServer(t, WithLogger(l))
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ReadFrame(conn); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	srv.Stop()
+
+	got := buf.String()
+	for _, want := range []string{`msg="service ready"`, `msg="close client" remote=127.0.0.1:`, " client=1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("wanted %s in %s\n", want, got)
+		}
+	}
+}
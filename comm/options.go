@@ -0,0 +1,217 @@
+package comm
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	sp "github.com/kenix/gomad/supplier"
+	"github.com/kenix/gomad/util"
+)
+
+const (
+	defaultQueueSize  = 256
+	defaultPolicy     = DropOldest
+	defaultInterval   = time.Second
+	defaultBufferSize = 1024
+	defaultHandshake  = 10 * time.Second
+)
+
+// Option configures a Server created by NewServer.
+type Option func(*Server)
+
+// WithQueue sets the per client queue size and the policy applied when a
+// client's queue is full.
+func WithQueue(size int, p Policy) Option {
+	return func(srv *Server) {
+		if size < 0 {
+			size = 0
+		}
+		srv.queueSize = size
+		srv.policy = p
+	}
+}
+
+// WithBlockTimeout sets how long the Block policy waits for queue space.
+func WithBlockTimeout(d time.Duration) Option {
+	return func(srv *Server) {
+		srv.blockTimeout = d
+	}
+}
+
+// WithInterval sets how often the supplier is polled for data.
+func WithInterval(d time.Duration) Option {
+	return func(srv *Server) {
+		if d > 0 {
+			srv.interval = d
+		}
+	}
+}
+
+// WithBufferSize sets the size of the buffer handed to the supplier, i.e. the
+// maximum size of data broadcast at once.
+func WithBufferSize(n int) Option {
+	return func(srv *Server) {
+		if n > 0 {
+			srv.bufferSize = n
+		}
+	}
+}
+
+// WithPush switches the server to push mode: instead of polling, the supplier
+// is asked for data whenever a cue is received on ch. Suppliers implementing
+// supplier.Notifier are served in push mode without this option.
+func WithPush(ch <-chan util.Cue) Option {
+	return func(srv *Server) {
+		srv.push = ch
+	}
+}
+
+// WithTopic adds supplier s under topic, its data is only sent to clients
+// subscribed to topic. Start fails for topics longer than MaxTopicLength.
+func WithTopic(topic string, s sp.Supplier) Option {
+	return func(srv *Server) {
+		srv.topics = append(srv.topics, newFeed(topic, s))
+	}
+}
+
+// WithTLS serves clients over TLS using cfg. Set cfg.ClientAuth and
+// cfg.ClientCAs to verify client certificates.
+func WithTLS(cfg *tls.Config) Option {
+	return func(srv *Server) {
+		srv.tlsConfig = cfg
+	}
+}
+
+// WithAuth sets the authenticator run on every accepted connection before the
+// client is added to the broadcast set.
+func WithAuth(auth Authenticator) Option {
+	return func(srv *Server) {
+		srv.auth = auth
+	}
+}
+
+// WithOrigins only upgrades WebSocket requests from the given origins, e.g.
+// "https://example.com". Without, requests from browsers must be same origin.
+// Requests without Origin header, i.e. not from browsers, are always upgraded.
+func WithOrigins(origins ...string) Option {
+	return func(srv *Server) {
+		srv.origins = append(srv.origins, origins...)
+	}
+}
+
+// WithHandshakeTimeout limits the time a connection may take for the TLS
+// handshake and authentication.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(srv *Server) {
+		if d > 0 {
+			srv.handshakeTimeout = d
+		}
+	}
+}
+
+// WithReplay keeps the last n frames broadcast, so that clients can request
+// them with the REPLAY command.
+func WithReplay(n int) Option {
+	return func(srv *Server) {
+		if n > 0 {
+			srv.replay = newRing(n)
+		}
+	}
+}
+
+// WithReplayStore persists the replay buffer in the sdb file at path on
+// shutdown and restores it on start, sequence numbers continue from the last
+// frame stored. It has no effect without WithReplay.
+func WithReplayStore(path string) Option {
+	return func(srv *Server) {
+		srv.replayStore = path
+	}
+}
+
+// WithHeartbeat sends a heartbeat frame to clients idle for d.
+func WithHeartbeat(d time.Duration) Option {
+	return func(srv *Server) {
+		srv.heartbeat = d
+	}
+}
+
+// WithReadTimeout disconnects clients sending nothing for d. Clients are
+// expected to send PING commands to stay connected.
+func WithReadTimeout(d time.Duration) Option {
+	return func(srv *Server) {
+		srv.readTimeout = d
+	}
+}
+
+// WithWriteTimeout disconnects clients a write to doesn't complete within d.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(srv *Server) {
+		srv.writeTimeout = d
+	}
+}
+
+// WithMaxConns limits the number of clients connected at the same time.
+func WithMaxConns(n int) Option {
+	return func(srv *Server) {
+		srv.maxConns = n
+	}
+}
+
+// WithMaxConnsPerIP limits the number of clients connected from the same
+// remote IP at the same time.
+func WithMaxConnsPerIP(n int) Option {
+	return func(srv *Server) {
+		srv.maxPerIP = n
+	}
+}
+
+// WithAcceptRate limits accepting connections to rate per second on average
+// with bursts up to burst, excess connections are rejected.
+func WithAcceptRate(rate float64, burst int) Option {
+	return func(srv *Server) {
+		if rate > 0 {
+			srv.acceptRate = newTokenBucket(rate, burst)
+		}
+	}
+}
+
+// WithAllow only accepts connections from the given CIDRs, e.g. "10.0.0.0/8".
+func WithAllow(cidrs ...string) Option {
+	return func(srv *Server) {
+		srv.allow = append(srv.allow, cidrs...)
+	}
+}
+
+// WithDeny rejects connections from the given CIDRs, it takes precedence over
+// WithAllow.
+func WithDeny(cidrs ...string) Option {
+	return func(srv *Server) {
+		srv.deny = append(srv.deny, cidrs...)
+	}
+}
+
+// WithBatch lets clients send up to n queued frames at once, using vectored
+// I/O (writev) where the connection supports it.
+func WithBatch(n int) Option {
+	return func(srv *Server) {
+		srv.batch = n
+	}
+}
+
+// WithLogger sets the logger of the server and its clients, client records
+// carry the client's remote address and id. Defaults to the util loggers.
+func WithLogger(l *slog.Logger) Option {
+	return func(srv *Server) {
+		srv.log = l
+	}
+}
+
+// WithMaxSupplierErrors ends a supplier's feed after n errors in a row, by
+// default errors are logged and counted only. Suppliers failing for good, see
+// supplier.Failer, or failing after they stopped pushing end their feed anyway.
+func WithMaxSupplierErrors(n int) Option {
+	return func(srv *Server) {
+		srv.maxErrors = n
+	}
+}
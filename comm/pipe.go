@@ -0,0 +1,54 @@
+package comm
+
+import (
+	"net"
+	"sync"
+
+	"github.com/kenix/gomad/util"
+)
+
+// PipeListener is an in-memory net.Listener handing out one end of a net.Pipe
+// per Dial, e.g. to run a Server in tests without network.
+type PipeListener struct {
+	conns chan net.Conn
+	done  chan util.Cue
+	once  sync.Once
+}
+
+func NewPipeListener() *PipeListener {
+	return &PipeListener{conns: make(chan net.Conn), done: make(chan util.Cue)}
+}
+
+// Dial connects to the listener, returns the client end of the pipe.
+func (l *PipeListener) Dial() (net.Conn, error) {
+	c, s := net.Pipe()
+	select {
+	case l.conns <- s:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *PipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
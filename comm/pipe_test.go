@@ -0,0 +1,51 @@
+package comm
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPipeListener(t *testing.T) {
+	l := NewPipeListener()
+	srv := NewServerListener(l, supplierMock("tick"), WithInterval(time.Millisecond))
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSubscriber("pipe")
+	s.Dial = func(string) (net.Conn, error) { return l.Dial() }
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	f, err := s.Next()
+	if err != nil || string(f.Data) != "tick" {
+		t.Errorf("wanted tick, got %s: %v\n", &f, err)
+	}
+
+	srv.Stop()
+	if _, err := l.Dial(); err != net.ErrClosed {
+		t.Errorf("wanted %v, got %v\n", net.ErrClosed, err)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tick.sock")
+	srv := NewServer("unix://"+path, supplierMock("tick"), WithInterval(time.Millisecond))
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if f, err := ReadFrame(conn); err != nil || string(f.Data) != "tick" {
+		t.Errorf("wanted tick, got %s: %v\n", &f, err)
+	}
+}
@@ -0,0 +1,32 @@
+package comm
+
+import "fmt"
+
+// Policy decides what happens to broadcast data when a client's queue is full.
+type Policy int
+
+const (
+	// DropOldest discards the oldest queued data to make room for new data.
+	DropOldest Policy = iota
+	// DropNewest discards the new data and keeps the queue as is.
+	DropNewest
+	// Disconnect closes the connection of a client whose queue is full.
+	Disconnect
+	// Block waits up to the block timeout for queue space, then drops the new
+	// data. A non-positive timeout waits forever.
+	Block
+)
+
+func (p Policy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	case Disconnect:
+		return "disconnect"
+	case Block:
+		return "block"
+	}
+	return fmt.Sprintf("policy(%d)", int(p))
+}
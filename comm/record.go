@@ -0,0 +1,348 @@
+package comm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/sdb"
+	"github.com/kenix/gomad/util"
+)
+
+// Record is a frame received at a point in time.
+type Record struct {
+	Time  time.Time
+	Frame Frame
+}
+
+// RecordWriter stores records.
+type RecordWriter interface {
+	WriteRecord(r Record) error
+	io.Closer
+}
+
+// RecordReader reads stored records in order, returns io.EOF after the last.
+type RecordReader interface {
+	ReadRecord() (Record, error)
+	io.Closer
+}
+
+// encodeRecord encodes r as the time in nanoseconds since epoch followed by
+// the encoded frame.
+func encodeRecord(r Record) []byte {
+	buf := bb.New(8 + r.Frame.Len()).OrderTo(binary.BigEndian)
+	buf.PutUint64(uint64(r.Time.UnixNano()))
+	r.Frame.Encode(buf)
+	return buf.Flip().GetN(buf.Remaining())
+}
+
+type recordFile struct {
+	f  *os.File
+	w  *bufio.Writer
+	rd *bufio.Reader
+}
+
+// CreateRecordFile creates a file at path to write records to sequentially.
+func CreateRecordFile(path string) (RecordWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &recordFile{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// OpenRecordFile opens a file written by CreateRecordFile for reading.
+func OpenRecordFile(path string) (RecordReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &recordFile{f: f, rd: bufio.NewReader(f)}, nil
+}
+
+func (rf *recordFile) WriteRecord(r Record) error {
+	_, err := rf.w.Write(encodeRecord(r))
+	return err
+}
+
+func (rf *recordFile) ReadRecord() (Record, error) {
+	var r Record
+	ts := make([]byte, 8)
+	if _, err := io.ReadFull(rf.rd, ts); err != nil {
+		return r, err
+	}
+	r.Time = time.Unix(0, int64(binary.BigEndian.Uint64(ts)))
+	f, err := ReadFrame(rf.rd)
+	if err != nil {
+		return r, unexpected(err)
+	}
+	r.Frame = f
+	return r, nil
+}
+
+func (rf *recordFile) Close() error {
+	if rf.w != nil {
+		if err := rf.w.Flush(); err != nil {
+			rf.f.Close()
+			return err
+		}
+	}
+	return rf.f.Close()
+}
+
+// recordDB stores records in an sdb file keyed by sequence number, the range
+// of sequence numbers under replayMetaKey. Records with the same sequence
+// number overwrite each other.
+type recordDB struct {
+	w           sdb.Writer
+	r           sdb.Reader
+	first, last uint64
+}
+
+// CreateRecordDB creates an sdb file at path to write records to, it is
+// complete after closing.
+func CreateRecordDB(path string) (RecordWriter, error) {
+	os.Remove(path)
+	w, err := sdb.NewWriter(path)
+	if err != nil {
+		return nil, err
+	}
+	return &recordDB{w: w}, nil
+}
+
+// OpenRecordDB opens an sdb file written by CreateRecordDB for reading.
+func OpenRecordDB(path string) (RecordReader, error) {
+	r, err := sdb.NewReader(path)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.Get(replayMetaKey)
+	if err != nil || len(meta) != 16 {
+		r.Close()
+		if err == nil {
+			err = ErrFrame
+		}
+		return nil, err
+	}
+	return &recordDB{r: r, first: binary.BigEndian.Uint64(meta),
+		last: binary.BigEndian.Uint64(meta[8:])}, nil
+}
+
+func (db *recordDB) WriteRecord(r Record) error {
+	if db.first == 0 || r.Frame.Seq < db.first {
+		db.first = r.Frame.Seq
+	}
+	if r.Frame.Seq > db.last {
+		db.last = r.Frame.Seq
+	}
+	_, err := db.w.Put(replayKey(r.Frame.Seq), encodeRecord(r))
+	return err
+}
+
+func (db *recordDB) ReadRecord() (Record, error) {
+	var r Record
+	for ; db.first > 0 && db.first <= db.last; db.first++ {
+		b, err := db.r.Get(replayKey(db.first))
+		if err != nil {
+			return r, err
+		}
+		if len(b) == 0 {
+			continue
+		}
+		if len(b) < 8 {
+			return r, ErrFrame
+		}
+		r.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+		if r.Frame, _, err = DecodeFrame(b[8:]); err != nil {
+			return r, err
+		}
+		db.first++
+		return r, nil
+	}
+	return r, io.EOF
+}
+
+func (db *recordDB) Close() error {
+	if db.r != nil {
+		return db.r.Close()
+	}
+	meta := make([]byte, 16)
+	binary.BigEndian.PutUint64(meta, db.first)
+	binary.BigEndian.PutUint64(meta[8:], db.last)
+	if _, err := db.w.Put(replayMetaKey, meta); err != nil {
+		db.w.Close()
+		return err
+	}
+	return db.w.Close()
+}
+
+// Recorder writes every frame a subscriber receives into a RecordWriter,
+// stamped with the time of receipt.
+type Recorder struct {
+	sub *Subscriber
+	w   RecordWriter
+	n   uint64
+}
+
+func NewRecorder(sub *Subscriber, w RecordWriter) *Recorder {
+	return &Recorder{sub: sub, w: w}
+}
+
+// Run records until the subscriber fails or is closed, it returns the
+// subscriber's error, nil if closed.
+func (rec *Recorder) Run() error {
+	for {
+		f, err := rec.sub.Next()
+		if err == ErrClosed {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := rec.w.WriteRecord(Record{time.Now(), f}); err != nil {
+			return err
+		}
+		rec.n++
+	}
+}
+
+// Recorded returns the number of records written, only to be called after
+// Run returned.
+func (rec *Recorder) Recorded() uint64 {
+	return rec.n
+}
+
+// ReplaySupplier is a push supplier feeding recorded data back into a Server,
+// paced by the time of the records.
+type ReplaySupplier struct {
+	r       RecordReader
+	speed   float64
+	topic   string
+	pending chan []byte
+	notify  chan util.Cue
+	done    chan util.Cue
+	ended   chan util.Cue // closed when replaying stopped
+	started sync.Once
+	once    sync.Once
+	err     error // valid once ended
+
+	// Log defaults to the comm logger, to be set before replaying starts.
+	Log *slog.Logger
+}
+
+// NewReplaySupplier replays the data of records read from r. speed scales
+// the original pacing, 1 replays at original speed, 2 twice as fast, 0 or
+// less as fast as the server takes it. Only records of topic are replayed,
+// all if topic is empty. Replaying starts at the first Notify, Get or
+// Supply, i.e. once a server starts serving the supplier.
+func NewReplaySupplier(r RecordReader, speed float64, topic string) *ReplaySupplier {
+	return &ReplaySupplier{r: r, speed: speed, topic: topic,
+		pending: make(chan []byte, 1), notify: make(chan util.Cue, 1),
+		done: make(chan util.Cue), ended: make(chan util.Cue), Log: defaultLogger}
+}
+
+func (rs *ReplaySupplier) start() {
+	rs.started.Do(func() { go rs.run() })
+}
+
+func (rs *ReplaySupplier) run() {
+	defer close(rs.notify)
+	defer close(rs.ended)
+	var base, start time.Time
+	for {
+		rec, err := rs.r.ReadRecord()
+		if err != nil {
+			if err != io.EOF {
+				rs.err = err
+				rs.Log.Error("failed replaying", "err", err)
+			}
+			return
+		}
+		if rec.Frame.Kind != KindData || rs.topic != "" && rec.Frame.Topic != rs.topic {
+			continue
+		}
+		if base.IsZero() {
+			base, start = rec.Time, time.Now()
+		}
+		if rs.speed > 0 {
+			due := start.Add(time.Duration(float64(rec.Time.Sub(base)) / rs.speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-rs.done:
+				return
+			}
+		}
+		select {
+		case rs.pending <- rec.Frame.Data:
+		case <-rs.done:
+			return
+		}
+		select {
+		case rs.notify <- util.Cue{}:
+		default: // already notified
+		}
+	}
+}
+
+// Get writes the data due, which must fit into buf.
+func (rs *ReplaySupplier) Get(buf bb.ByteBuffer) {
+	if _, err := rs.Supply(buf); err != nil && err != io.EOF {
+		rs.Log.Warn("failed replaying", "err", err)
+	}
+}
+
+// Supply writes the data due. Data not fitting into buf is discarded with
+// bytebuffer.ErrOverflow. After the last data io.EOF or the error replaying
+// failed with is returned.
+func (rs *ReplaySupplier) Supply(buf bb.ByteBuffer) (int, error) {
+	rs.start()
+	select {
+	case dat := <-rs.pending:
+		if len(dat) > buf.Remaining() {
+			return 0, fmt.Errorf("discarded replay data of %d byte(s): %w", len(dat), bb.ErrOverflow)
+		}
+		buf.PutN(dat)
+		return len(dat), nil
+	default:
+	}
+	select {
+	case <-rs.ended:
+		if len(rs.pending) > 0 {
+			return rs.Supply(buf)
+		}
+		if rs.err != nil {
+			return 0, rs.err
+		}
+		return 0, io.EOF
+	default:
+		return 0, nil
+	}
+}
+
+func (rs *ReplaySupplier) Notify() <-chan util.Cue {
+	rs.start()
+	return rs.notify
+}
+
+// Err returns the error replaying stopped with, nil if stopped at the end or
+// still replaying.
+func (rs *ReplaySupplier) Err() error {
+	select {
+	case <-rs.ended:
+		return rs.err
+	default:
+		return nil
+	}
+}
+
+// Close stops replaying.
+func (rs *ReplaySupplier) Close() error {
+	rs.once.Do(func() { close(rs.done) })
+	return nil
+}
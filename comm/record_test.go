@@ -0,0 +1,124 @@
+package comm
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		path   string
+		create func(string) (RecordWriter, error)
+		open   func(string) (RecordReader, error)
+	}{
+		{filepath.Join(dir, "ticks.rec"), CreateRecordFile, OpenRecordFile},
+		{filepath.Join(dir, "ticks.sdb"), CreateRecordDB, OpenRecordDB},
+	}
+
+	for _, c := range cases {
+		srv := startServer(t)
+		w, err := c.create(c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := NewSubscriber(srv.Addr().String())
+		if err := sub.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		rec := NewRecorder(sub, w)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			sub.Close()
+		}()
+		if err := rec.Run(); err != nil {
+			t.Fatal(err)
+		}
+		srv.Stop()
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Recorded() == 0 {
+			t.Fatalf("%s: wanted records, got none\n", c.path)
+		}
+
+		// replay the recording at half speed through another server started
+		// later than the recording lasted, live to a client connecting then
+		r, err := c.open(c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs := NewReplaySupplier(r, 0.5, "")
+		srv = NewServer("127.0.0.1:0", rs)
+		time.Sleep(150 * time.Millisecond)
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		conn, ok := dialRead(t, srv)
+		conn.Close()
+		srv.Stop()
+		rs.Close()
+		r.Close()
+		if !ok {
+			t.Errorf("%s: wanted replayed frames\n", c.path)
+		}
+	}
+}
+
+func TestReplaySupplierPacing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticks.rec")
+	w, err := CreateRecordFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		w.WriteRecord(Record{base.Add(time.Duration(i) * 20 * time.Millisecond),
+			Frame{Kind: KindData, Seq: uint64(i + 1), Data: []byte(fmt.Sprint(i))}})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{1, 80 * time.Millisecond, time.Second},
+		{4, 20 * time.Millisecond, 80 * time.Millisecond},
+	}
+	for _, c := range cases {
+		r, err := OpenRecordFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		rs := NewReplaySupplier(r, c.speed, "")
+		buf := bb.New(64)
+		for i := 0; i < 5; i++ {
+			<-rs.Notify()
+			buf.Clear()
+			rs.Get(buf)
+			if err := rs.Err(); err != nil { // while replaying
+				t.Error(err)
+			}
+			if got := string(buf.Flip().GetN(buf.Remaining())); got != fmt.Sprint(i) {
+				t.Errorf("wanted %d, got %s\n", i, got)
+			}
+		}
+		if _, ok := <-rs.Notify(); ok {
+			t.Error("wanted end of replay")
+		}
+		if d := time.Since(start); d < c.min || d > c.max {
+			t.Errorf("speed %g: wanted %s-%s, got %s\n", c.speed, c.min, c.max, d)
+		}
+		if rs.Err() != nil {
+			t.Error(rs.Err())
+		}
+		r.Close()
+	}
+}
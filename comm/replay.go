@@ -0,0 +1,185 @@
+package comm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/kenix/gomad/sdb"
+)
+
+// ring retains the last frames broadcast.
+type ring struct {
+	seqs   []uint64
+	topics []string
+	frames []*Buffer // encoded frames
+	start  int
+	n      int
+}
+
+func newRing(size int) *ring {
+	return &ring{seqs: make([]uint64, size), topics: make([]string, size),
+		frames: make([]*Buffer, size)}
+}
+
+// add retains frame, taking over the caller's reference, the frame evicted if
+// full is released.
+func (r *ring) add(seq uint64, topic string, frame *Buffer) {
+	i := (r.start + r.n) % len(r.frames)
+	if r.n == len(r.frames) {
+		r.frames[i].release()
+		r.start = (r.start + 1) % len(r.frames)
+	} else {
+		r.n++
+	}
+	r.seqs[i], r.topics[i], r.frames[i] = seq, topic, frame
+}
+
+// since returns the frames with sequence numbers from seq on, which topic
+// satisfies keep. A reference is taken on each returned frame.
+func (r *ring) since(seq uint64, keep func(topic string) bool) []*Buffer {
+	var frames []*Buffer
+	for k := 0; k < r.n; k++ {
+		i := (r.start + k) % len(r.frames)
+		if r.seqs[i] >= seq && keep(r.topics[i]) {
+			frames = append(frames, r.frames[i].retain())
+		}
+	}
+	return frames
+}
+
+// replayTo sends the retained frames from seq on to client c ahead of data
+// broadcast meanwhile. Without replay buffer only the replay marker is sent.
+func (srv *Server) replayTo(c *Client, dc DualChan, seq uint64) {
+	srv.omu.Lock() // no broadcast is offered to c meanwhile
+	srv.bmu.Lock()
+	var frames []*Buffer
+	if srv.replay != nil {
+		frames = srv.replay.since(seq, func(topic string) bool {
+			return topic == "" || c.Subscribed(topic)
+		})
+	}
+	c.replaying = true
+	srv.bmu.Unlock()
+	srv.omu.Unlock()
+
+	c.log.Info("replay", "frames", len(frames), "from", seq)
+	marker := Frame{Kind: KindReplay}
+	if len(frames) > 0 {
+		f, _, _ := DecodeFrame(frames[0].b)
+		marker.Seq = f.Seq
+	}
+	frames = append([]*Buffer{bufferOf(marker.Bytes())}, frames...)
+	for i, b := range frames {
+		select {
+		case dc.Out <- b:
+		case <-c.done:
+			for _, b := range frames[i:] {
+				b.release()
+			}
+			return
+		}
+	}
+
+	srv.omu.Lock() // the backlog goes ahead of further broadcasts
+	defer srv.omu.Unlock()
+	srv.bmu.Lock()
+	backlog := c.backlog
+	c.backlog, c.replaying = nil, false
+	srv.bmu.Unlock()
+	t := target{c, dc}
+	for _, b := range backlog {
+		srv.deliver(t, b)
+		b.release()
+	}
+}
+
+const replayMetaKey = "meta"
+
+func replayKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// saveReplay writes the replay buffer into the replay store if configured.
+// Frames are stored under their zero padded sequence numbers, the range of
+// sequence numbers under replayMetaKey.
+func (srv *Server) saveReplay() error {
+	if srv.replay == nil || srv.replayStore == "" {
+		return nil
+	}
+	srv.bmu.Lock()
+	defer srv.bmu.Unlock()
+	tmp := srv.replayStore + ".tmp"
+	os.Remove(tmp)
+	w, err := sdb.NewWriter(tmp)
+	if err != nil {
+		return err
+	}
+	r := srv.replay
+	meta := make([]byte, 16)
+	if r.n > 0 {
+		binary.BigEndian.PutUint64(meta, r.seqs[r.start])
+		binary.BigEndian.PutUint64(meta[8:], r.seqs[(r.start+r.n-1)%len(r.seqs)])
+	}
+	if _, err := w.Put(replayMetaKey, meta); err != nil {
+		w.Close()
+		return err
+	}
+	for k := 0; k < r.n; k++ {
+		i := (r.start + k) % len(r.frames)
+		if _, err := w.Put(replayKey(r.seqs[i]), r.frames[i].b); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, srv.replayStore)
+}
+
+// loadReplay restores the replay buffer from the replay store if configured
+// and existing.
+func (srv *Server) loadReplay() error {
+	if srv.replay == nil || srv.replayStore == "" {
+		return nil
+	}
+	if _, err := os.Stat(srv.replayStore); os.IsNotExist(err) {
+		return nil
+	}
+	rd, err := sdb.NewReader(srv.replayStore)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	meta, err := rd.Get(replayMetaKey)
+	if err != nil {
+		return err
+	}
+	if len(meta) != 16 {
+		return ErrFrame
+	}
+
+	srv.bmu.Lock()
+	defer srv.bmu.Unlock()
+	first, last := binary.BigEndian.Uint64(meta), binary.BigEndian.Uint64(meta[8:])
+	for seq := first; seq > 0 && seq <= last; seq++ {
+		b, err := rd.Get(replayKey(seq))
+		if err != nil {
+			return err
+		}
+		if b == nil { // not broadcast to anyone
+			continue
+		}
+		f, _, err := DecodeFrame(b)
+		if err != nil {
+			return err
+		}
+		srv.replay.add(f.Seq, f.Topic, bufferOf(b))
+	}
+	if last > srv.seq {
+		srv.seq = last
+	}
+	srv.log.Info("loaded replay", "first", first, "last", last, "store", srv.replayStore)
+	return nil
+}
@@ -0,0 +1,80 @@
+package comm
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readSeqs connects to srv, optionally requests replay from seq and returns
+// the sequence numbers of the next n frames, replayed ones first.
+func readSeqs(t *testing.T, srv *Server, replay uint64, n int) []uint64 {
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if replay > 0 {
+		fmt.Fprintf(conn, "REPLAY %d\n", replay)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	seqs := make([]uint64, 0, n)
+	replayed := replay == 0
+	for len(seqs) < n {
+		f, err := ReadFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case f.Kind == KindReplay:
+			replayed = true
+		case replayed:
+			seqs = append(seqs, f.Seq)
+		}
+	}
+	return seqs
+}
+
+func TestReplay(t *testing.T) {
+	srv := startServer(t, WithReplay(16))
+	defer srv.Stop()
+
+	seqs := readSeqs(t, srv, 0, 8)
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("wanted consecutive sequence numbers, got %v\n", seqs)
+		}
+	}
+
+	from := seqs[len(seqs)-1]
+	seqs = readSeqs(t, srv, from, 32)
+	if seqs[0] != from {
+		t.Errorf("wanted replay from %d, got %d\n", from, seqs[0])
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("wanted consecutive sequence numbers, got %v\n", seqs)
+		}
+	}
+}
+
+func TestReplayStore(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "replay.sdb")
+	srv := startServer(t, WithReplay(4), WithReplayStore(store))
+	last := readSeqs(t, srv, 0, 8)[7]
+	srv.Stop()
+
+	srv = startServer(t, WithReplay(4), WithReplayStore(store))
+	defer srv.Stop()
+	seqs := readSeqs(t, srv, 1, 8)
+	if seqs[0]+3 < last {
+		t.Errorf("wanted replay of the last 4 frames stored after %d, got %v\n", last, seqs)
+	}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("wanted consecutive sequence numbers, got %v\n", seqs)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package comm
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	bb "github.com/kenix/gomad/bytebuffer"
@@ -13,113 +18,467 @@ import (
 )
 
 type Server struct {
-	service   string
-	supplier  sp.Supplier
-	clients   map[*Client]DualChan
-	done      chan util.Cue
-	monitorCh chan *Client
-	wgGroup   sync.WaitGroup
+	service      string
+	feeds        []*feed
+	mu           sync.Mutex // guards clients, reserved, perIP, rejected and listener
+	clients      map[*Client]DualChan
+	reserved     int            // client slots of connections being admitted
+	perIP        map[string]int // clients and reserved slots per IP
+	rejected     map[string]uint64
+	listener     net.Listener
+	done         chan util.Cue
+	monitorCh    chan *Client
+	wgGroup      sync.WaitGroup // accept and serve
+	wgClients    sync.WaitGroup // client goroutines
+	wgMonitor    sync.WaitGroup
+	queueSize    int
+	policy       Policy
+	blockTimeout time.Duration
+	interval     time.Duration
+	bufferSize   int
+	push         <-chan util.Cue
+	topics       []*feed
+	drops        uint64
+	total        traffic
+	broadcasts   uint64
+	supplied     uint64
+	started      time.Time
+	omu          sync.Mutex // orders broadcasts, held while offering, locked before bmu
+	bmu          sync.Mutex // guards seq, latest, replay and client backlogs
+	seq          uint64
+	scratch      []target           // reused for broadcasting, guarded by omu
+	latest       map[string]*Buffer // latest frame per topic
+	replay       *ring
+	replayStore  string
+
+	tlsConfig        *tls.Config
+	auth             Authenticator
+	origins          []string
+	handshakeTimeout time.Duration
+	heartbeat        time.Duration
+	batch            int
+	maxConns         int
+	maxPerIP         int
+	acceptRate       *tokenBucket
+	allow, deny      []string
+	allowNets        []*net.IPNet
+	denyNets         []*net.IPNet
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	stopOnce         sync.Once
+	log              *slog.Logger
+	ids              uint64 // of the last client added
+	maxErrors        int    // consecutive errors after which a feed ends
+	supplierErrors   uint64
+	live             int32 // feeds not ended
+	exhausted        chan util.Cue
+}
+
+var ErrClosed = errors.New("comm: server closed")
+
+// NewServer creates a server listening on service, a TCP address or a Unix
+// domain socket path prefixed by "unix://". Data of supplier is
+// broadcast to all clients, data of suppliers added with WithTopic only to
+// clients subscribed to the topic. supplier may be nil if only topics are
+// served.
+func NewServer(service string, supplier sp.Supplier, opts ...Option) *Server {
+	srv := &Server{service: service,
+		clients: make(map[*Client]DualChan), done: make(chan util.Cue),
+		perIP: make(map[string]int), rejected: make(map[string]uint64),
+		latest:    make(map[string]*Buffer),
+		monitorCh: make(chan *Client, 1),
+		queueSize: defaultQueueSize, policy: defaultPolicy,
+		interval: defaultInterval, bufferSize: defaultBufferSize,
+		handshakeTimeout: defaultHandshake, log: defaultLogger,
+		exhausted: make(chan util.Cue)}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	if supplier != nil {
+		f := newFeed("", supplier)
+		if srv.push != nil {
+			f.push = srv.push
+		}
+		srv.feeds = append(srv.feeds, f)
+	}
+	srv.feeds = append(srv.feeds, srv.topics...)
+	return srv
 }
 
-func NewServer(service string, supplier sp.Supplier) *Server {
-	return &Server{service, supplier,
-		make(map[*Client]DualChan), make(chan util.Cue),
-		make(chan *Client, 1), sync.WaitGroup{}}
+// NewServerListener creates a server accepting clients from listener, e.g. a
+// Unix domain socket listener or an in-memory PipeListener.
+func NewServerListener(listener net.Listener, supplier sp.Supplier, opts ...Option) *Server {
+	srv := NewServer(listener.Addr().String(), supplier, opts...)
+	srv.listener = listener
+	return srv
+}
+
+// splitService splits a service into network and address, "unix:///tmp/s"
+// denotes a Unix domain socket, services without scheme TCP.
+func splitService(service string) (string, string) {
+	if i := strings.Index(service, "://"); i > 0 {
+		return service[:i], service[i+3:]
+	}
+	return "tcp", service
 }
 
 func (srv *Server) Start() error {
-	util.Li.Printf("to listen @%s\n", srv.service)
-	listener, err := net.Listen("tcp", srv.service)
-	if err != nil {
-		util.Le.Printf("failed listening @ %s: %s\n", srv.service, err)
+	for _, f := range srv.topics {
+		if len(f.topic) > MaxTopicLength {
+			err := fmt.Errorf("topic of %d byte(s): %w", len(f.topic), ErrFrame)
+			srv.log.Error("invalid topic", "err", err)
+			return err
+		}
+	}
+	srv.mu.Lock()
+	listener := srv.listener
+	srv.mu.Unlock()
+	if listener == nil {
+		srv.log.Info("to listen", "service", srv.service)
+		var err error
+		if listener, err = net.Listen(splitService(srv.service)); err != nil {
+			srv.log.Error("failed listening", "service", srv.service, "err", err)
+			return err
+		}
+	}
+	if err := srv.parseCIDRs(); err != nil {
+		listener.Close()
+		srv.log.Error("failed parsing CIDRs", "err", err)
 		return err
 	}
-	util.Li.Printf("service ready @%s\n", srv.service)
-	go srv.accept(listener)
+	if err := srv.loadReplay(); err != nil {
+		listener.Close()
+		srv.log.Error("failed loading replay", "store", srv.replayStore, "err", err)
+		return err
+	}
+	if srv.tlsConfig != nil {
+		listener = tls.NewListener(listener, srv.tlsConfig)
+	}
+	srv.mu.Lock()
+	srv.listener = listener
+	srv.started = time.Now()
+	srv.mu.Unlock()
+	srv.log.Info("service ready", "addr", addrOf(listener.Addr()))
+	srv.wgMonitor.Add(1)
 	go srv.monitor()
-	go srv.serve(listener)
+	srv.live = int32(len(srv.feeds))
+	srv.wgGroup.Add(1 + len(srv.feeds))
+	go srv.accept(listener)
+	for _, f := range srv.feeds {
+		go srv.serve(f)
+	}
 	return nil
 }
 
+// Addr returns the address the server listens on, nil if not started.
+func (srv *Server) Addr() net.Addr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.listener == nil {
+		return nil
+	}
+	return srv.listener.Addr()
+}
+
 func (srv *Server) accept(listener net.Listener) {
-	srv.wgGroup.Add(1)
 	defer srv.wgGroup.Done()
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			if strings.Contains(err.Error(), "closed network") {
-				util.Li.Println("stopped accepting connections")
+			if errors.Is(err, net.ErrClosed) {
+				srv.log.Info("stopped accepting connections")
 				return
 			}
-			util.Le.Println(err)
+			srv.log.Error("failed accepting connection", "err", err)
+			continue
+		}
+		srv.log.Info("got connection", "remote", addrOf(conn.RemoteAddr()))
+		if reason := srv.screen(conn); reason != "" {
+			srv.reject(conn, reason, nil)
 			continue
 		}
-		util.Li.Printf("got connection from %s\n", conn.RemoteAddr())
-		dc := DualChan{make(chan []byte), make(chan []byte)}
-		client := NewClient(conn)
-		srv.clients[client] = dc
-		go client.Do(dc, srv.monitorCh)
+		if !srv.handshaking(conn) {
+			srv.add(conn, false)
+			continue
+		}
+		if srv.reserve(conn) != nil {
+			continue
+		}
+		srv.wgGroup.Add(1)
+		go func() {
+			defer srv.wgGroup.Done()
+			srv.handshake(conn)
+		}()
 	}
 }
 
-func (srv *Server) monitor() {
-	srv.wgGroup.Add(1)
-	defer srv.wgGroup.Done()
-	util.Li.Println("started monitoring")
-	for c := range srv.monitorCh {
-		close(srv.clients[c].Out)
-		c.Close()
-		delete(srv.clients, c)
+// handshaking denotes if conn has to complete a TLS handshake or to be
+// authenticated before being added as a client.
+func (srv *Server) handshaking(conn net.Conn) bool {
+	_, ok := conn.(*tls.Conn)
+	return ok || srv.auth != nil
+}
+
+// admit adds conn as a client, completing the TLS handshake and
+// authenticating it first if need be.
+func (srv *Server) admit(conn net.Conn) error {
+	if !srv.handshaking(conn) {
+		return srv.add(conn, false)
+	}
+	if err := srv.reserve(conn); err != nil {
+		return err
 	}
-	util.Li.Println("stopped monitoring")
+	return srv.handshake(conn)
 }
 
-func (srv *Server) serve(listener net.Listener) {
-	buf := bb.New(1024)
-	srv.wgGroup.Add(1)
-	defer srv.wgGroup.Done()
-	util.Li.Println("started serving")
-	for {
+// reserve reserves a client slot for conn during its handshake, so that
+// connection limits hold for connections not yet added, too. It returns
+// ErrLimit if limits are reached.
+func (srv *Server) reserve(conn net.Conn) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	ip := ipOf(conn.RemoteAddr())
+	if reason := srv.overLimitLocked(ip); reason != "" {
+		srv.rejectLocked(conn, reason, nil)
+		return ErrLimit
+	}
+	srv.reserved++
+	if ip != "" {
+		srv.perIP[ip]++
+	}
+	return nil
+}
+
+func (srv *Server) releaseLocked(ip string) {
+	srv.reserved--
+	if ip != "" {
+		if srv.perIP[ip]--; srv.perIP[ip] == 0 {
+			delete(srv.perIP, ip)
+		}
+	}
+}
+
+// handshake completes the TLS handshake and authenticates conn, which has a
+// client slot reserved, before adding it as a client.
+func (srv *Server) handshake(conn net.Conn) error {
+	fail := func(reason string, err error) error {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		srv.releaseLocked(ipOf(conn.RemoteAddr()))
+		srv.rejectLocked(conn, reason, err)
+		return err
+	}
+	admitted := make(chan util.Cue)
+	go func() { // don't hold up stopping
 		select {
 		case <-srv.done:
-			err := listener.Close()
-			if err != nil {
-				util.Le.Println(err)
-			}
-			srv.closeClients()
-			close(srv.monitorCh)
-			util.Li.Println("stopped serving")
-			return
-		case <-time.After(time.Second):
-			srv.supplier.Get(buf)
-			if buf.Flip().HasRemaining() {
-				srv.commData(buf.GetN(buf.Remaining()))
-			}
-			buf.Clear()
+			conn.Close()
+		case <-admitted:
+		}
+	}()
+	defer close(admitted)
+
+	conn.SetDeadline(time.Now().Add(srv.handshakeTimeout))
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return fail(RejectHandshake, err)
 		}
 	}
+	if srv.auth != nil {
+		if err := srv.auth(conn); err != nil {
+			return fail(RejectAuth, err)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return srv.add(conn, true)
+}
+
+// add registers a client for conn and starts serving it, unless the server is
+// stopping or connection limits are reached. The slot reserved for conn is
+// taken by the client if reserved.
+func (srv *Server) add(conn net.Conn, reserved bool) error {
+	dc := DualChan{make(chan []byte), make(chan *Buffer, srv.queueSize)}
+	client := NewClient(conn)
+	client.policy, client.timeout, client.stop = srv.policy, srv.blockTimeout, srv.done
+	client.heartbeat = srv.heartbeat
+	client.readTimeout, client.writeTimeout = srv.readTimeout, srv.writeTimeout
+	client.total = &srv.total
+	client.id = atomic.AddUint64(&srv.ids, 1)
+	client.log = srv.log.With("remote", addrOf(conn.RemoteAddr()), "client", client.id)
+	client.batch = srv.batch
+	client.ip = ipOf(conn.RemoteAddr())
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if reserved {
+		srv.releaseLocked(client.ip)
+	}
+	select {
+	case <-srv.done:
+		client.Close()
+		return ErrClosed
+	default:
+	}
+	if reason := srv.overLimitLocked(client.ip); reason != "" {
+		srv.rejectLocked(conn, reason, nil)
+		return ErrLimit
+	}
+	srv.clients[client] = dc
+	if client.ip != "" {
+		srv.perIP[client.ip]++
+	}
+	srv.wgClients.Add(3)
+	go func() {
+		defer srv.wgClients.Done()
+		client.Do(dc, srv.monitorCh)
+	}()
+	go func() {
+		defer srv.wgClients.Done()
+		client.Recv(dc, srv.monitorCh)
+	}()
+	go func() {
+		defer srv.wgClients.Done()
+		srv.handle(client, dc)
+	}()
+	return nil
+}
+
+// remove closes the given client and unregisters it if still registered.
+func (srv *Server) remove(c *Client) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.removeLocked(c)
+}
+
+func (srv *Server) removeLocked(c *Client) {
+	if _, ok := srv.clients[c]; !ok { // already closed
+		return
+	}
+	c.Close()
+	delete(srv.clients, c)
+	if c.ip != "" {
+		if srv.perIP[c.ip]--; srv.perIP[c.ip] == 0 {
+			delete(srv.perIP, c.ip)
+		}
+	}
+}
+
+func (srv *Server) monitor() {
+	defer srv.wgMonitor.Done()
+	srv.log.Debug("started monitoring")
+	for c := range srv.monitorCh {
+		srv.remove(c)
+	}
+	srv.log.Debug("stopped monitoring")
 }
 
 func (srv *Server) closeClients() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
 	for c := range srv.clients {
-		srv.monitorCh <- c
+		srv.removeLocked(c)
 	}
 }
 
-func (srv *Server) commData(dat []byte) {
-	for _, dc := range srv.clients {
-		select {
-		case dc.Out <- dat:
+type target struct {
+	c  *Client
+	dc DualChan
+}
+
+// targets returns a snapshot of the registered clients, so that data can be
+// queued without holding the lock.
+func (srv *Server) targets() []target {
+	return srv.appendTargets(nil)
+}
+
+func (srv *Server) appendTargets(ts []target) []target {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c, dc := range srv.clients {
+		ts = append(ts, target{c, dc})
+	}
+	return ts
+}
+
+// commData stamps the data remaining in src with the next sequence number and
+// queues it for all clients subscribed to topic, for all clients if topic is
+// empty. The frame is encoded once into a pooled buffer shared by all. Data
+// is offered without holding bmu, so that snapshots and replays don't wait
+// for slow clients.
+func (srv *Server) commData(topic string, src bb.ByteBuffer) {
+	srv.omu.Lock()
+	defer srv.omu.Unlock()
+	srv.bmu.Lock()
+	srv.seq++
+	n := src.Remaining()
+	b := newBuffer(frameHeader + len(topic) + n)
+	src.Read(b.b[putHeader(b.b, KindData, srv.seq, topic, n):])
+	defer b.release()
+	if old := srv.latest[topic]; old != nil {
+		old.release()
+	}
+	srv.latest[topic] = b.retain()
+
+	backlog := srv.queueSize // max. data held back per replaying client
+	if srv.replay != nil {
+		srv.replay.add(srv.seq, topic, b.retain())
+		backlog = len(srv.replay.frames)
+	}
+	srv.scratch = srv.appendTargets(srv.scratch[:0])
+	offers := srv.scratch[:0] // filtered in place
+	for _, t := range srv.scratch {
+		if topic != "" && !t.c.Subscribed(topic) {
+			continue
 		}
+		if t.c.replaying {
+			if len(t.c.backlog) < backlog {
+				t.c.backlog = append(t.c.backlog, b.retain())
+			} else {
+				t.c.drop()
+				atomic.AddUint64(&srv.drops, 1)
+			}
+			continue
+		}
+		offers = append(offers, t)
+	}
+	srv.bmu.Unlock()
+
+	for _, t := range offers {
+		srv.deliver(t, b)
+	}
+	for i := range srv.scratch { // don't hold on to closed clients
+		srv.scratch[i] = target{}
+	}
+}
+
+// deliver queues b for the client of t, disconnects it if too slow.
+func (srv *Server) deliver(t target, b *Buffer) {
+	drops := t.c.Drops()
+	if !t.c.offer(t.dc.Out, b) {
+		t.c.log.Warn("disconnect slow client")
+		srv.remove(t.c)
 	}
+	atomic.AddUint64(&srv.drops, t.c.Drops()-drops)
 }
 
+// Stop stops the server and closes all clients without waiting for queued
+// data to be sent.
 func (srv *Server) Stop() error {
-	close(srv.done)
-	srv.wgGroup.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := srv.Shutdown(ctx); err == ErrClosed {
+		return err
+	}
 	return nil
 }
 
+// Drops returns the total number of broadcast data dropped for slow clients.
+func (srv *Server) Drops() uint64 {
+	return atomic.LoadUint64(&srv.drops)
+}
+
 func (srv *Server) Status() string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
 	return fmt.Sprintf("%d client(s)", len(srv.clients))
 }
@@ -0,0 +1,220 @@
+package comm
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+	sp "github.com/kenix/gomad/supplier"
+	"github.com/kenix/gomad/util"
+)
+
+func init() {
+	util.InitLoggers(ioutil.Discard)
+}
+
+type supplierMock string
+
+func (s supplierMock) Get(buf bb.ByteBuffer) {
+	buf.Write([]byte(s))
+}
+
+func startServer(t testing.TB, opts ...Option) *Server {
+	opts = append([]Option{WithInterval(time.Millisecond)}, opts...)
+	srv := NewServer("127.0.0.1:0", supplierMock("tick"), opts...)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func TestConnectDisconnect(t *testing.T) {
+	srv := startServer(t)
+	addr := srv.Addr().String()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 4)
+			for j := 0; j < 16; j++ {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if _, err := conn.Read(buf); err != nil {
+					t.Error(err)
+				}
+				srv.Status()
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := srv.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Status(); got != "0 client(s)" {
+		t.Errorf("wanted 0 client(s), got %s\n", got)
+	}
+}
+
+func TestPush(t *testing.T) {
+	push := make(chan util.Cue)
+	srv := startServer(t, WithPush(push), WithBufferSize(2))
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for srv.Status() != "1 client(s)" {
+		time.Sleep(time.Millisecond)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if f, err := ReadFrame(conn); err == nil {
+		t.Errorf("wanted no data without push, got %s\n", &f)
+	}
+
+	push <- util.Cue{}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	f, err := ReadFrame(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.Data); got != "ti" {
+		t.Errorf("wanted ti, got %s\n", got)
+	}
+}
+
+func TestTopics(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", nil, WithInterval(time.Millisecond),
+		WithTopic("a", supplierMock("A")), WithTopic("b", supplierMock("B")))
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("sub a\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 8; i++ {
+		f, err := ReadFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Topic != "a" || string(f.Data) != "A" {
+			t.Fatalf("wanted only a;A, got %s;%s\n", f.Topic, f.Data)
+		}
+	}
+}
+
+func TestTopicTooLong(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", nil,
+		WithTopic(strings.Repeat("a", MaxTopicLength+1), supplierMock("A")))
+	err := srv.Start()
+	if err == nil {
+		srv.Stop()
+	}
+	if !errors.Is(err, ErrFrame) {
+		t.Errorf("wanted %v, got %v\n", ErrFrame, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	srv := startServer(t, WithBatch(8))
+	defer srv.Stop()
+
+	seqs := readSeqs(t, srv, 0, 64)
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] != seqs[i-1]+1 {
+			t.Fatalf("wanted %d, got %d\n", seqs[i-1]+1, seqs[i])
+		}
+	}
+}
+
+// failingSupplier supplies "x" and fails each time.
+type failingSupplier struct{}
+
+func (failingSupplier) Get(buf bb.ByteBuffer) {}
+
+func (failingSupplier) Supply(buf bb.ByteBuffer) (int, error) {
+	buf.Write([]byte("x"))
+	return 1, errors.New("failing")
+}
+
+// pushSource is a push source not telling if it failed for good.
+type pushSource struct {
+	sp.Source
+	sp.Notifier
+}
+
+// sdbMock reads the data of its keys, fails for keys missing.
+type sdbMock map[string][]byte
+
+func (m sdbMock) Get(key string) ([]byte, error) {
+	if dat, ok := m[key]; ok {
+		return dat, nil
+	}
+	return nil, errors.New("broken")
+}
+
+func (sdbMock) Underlying() string { return "mock" }
+
+func (sdbMock) Close() error { return nil }
+
+func TestExhausted(t *testing.T) {
+	ch := make(chan []byte, 3)
+	for _, s := range []string{"a", "b", "c"} {
+		ch <- []byte(s)
+	}
+	close(ch)
+	rd := sp.NewReader(strings.NewReader("a\nb\nc\n"+strings.Repeat("x", 1<<17)), nil) // too long a line
+	db := sdbMock{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")}
+	cases := []struct {
+		name   string
+		s      sp.Supplier
+		opts   []Option
+		errors uint64
+	}{
+		{"eof", sp.NewChan(ch), nil, 0},
+		{"errors", failingSupplier{}, []Option{WithMaxSupplierErrors(3)}, 3},
+		{"push failed", pushSource{rd, rd}, nil, 1},
+		{"sdb failed", sp.NewSDB(db, sp.KeyList("a", "b", "c", "d")), nil, 1},
+	}
+	for _, c := range cases {
+		srv := NewServer("127.0.0.1:0", c.s, append(c.opts, WithInterval(time.Millisecond))...)
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-srv.Exhausted():
+		case <-time.After(time.Second):
+			t.Errorf("%s: wanted exhausted\n", c.name)
+		}
+		st := srv.Stats()
+		if st.Broadcasts != 3 || st.SupplierErrors != c.errors {
+			t.Errorf("%s: wanted 3 broadcasts and %d error(s), got %d and %d\n",
+				c.name, c.errors, st.Broadcasts, st.SupplierErrors)
+		}
+		srv.Stop()
+	}
+}
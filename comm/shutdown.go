@@ -0,0 +1,99 @@
+package comm
+
+import (
+	"context"
+	"net"
+
+	"github.com/kenix/gomad/util"
+)
+
+// ClientOutcome reports how a client was shut down.
+type ClientOutcome struct {
+	Remote  string
+	Bytes   uint64 // bytes sent in total
+	Pending int    // data left unsent in the client's queue
+	Err     error  // nil if all queued data was sent
+}
+
+// Shutdown stops accepting connections and supplying data, then sends data
+// already queued to the clients until ctx is done. Clients not drained by then
+// are closed forcibly. It returns the outcome per client and ctx's error if
+// any client was closed forcibly.
+func (srv *Server) Shutdown(ctx context.Context) ([]ClientOutcome, error) {
+	first := false
+	srv.stopOnce.Do(func() { first = true })
+	if !first {
+		return nil, ErrClosed
+	}
+
+	close(srv.done)
+	srv.mu.Lock()
+	listener := srv.listener
+	srv.mu.Unlock()
+	if listener != nil {
+		if err := listener.Close(); err != nil {
+			srv.log.Error("failed closing listener", "err", err)
+		}
+	}
+	var err error
+	waited := make(chan util.Cue)
+	go func() {
+		srv.wgGroup.Wait() // no more clients or data after this
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-ctx.Done(): // feeds still offering
+		err = ctx.Err()
+		for _, t := range srv.targets() {
+			t.c.Close()
+		}
+		<-waited
+	}
+
+	ts := srv.targets()
+	for _, t := range ts {
+		close(t.c.drain)
+	}
+	for _, t := range ts {
+		if err != nil {
+			break
+		}
+		select {
+		case <-t.c.drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	outcomes := make([]ClientOutcome, 0, len(ts))
+	for _, t := range ts {
+		o := ClientOutcome{Remote: t.c.conn.RemoteAddr().String()}
+		o.Pending = len(t.dc.Out)
+		select {
+		case <-t.c.drained:
+			if o.Err = t.c.failure(); o.Err == nil && o.Pending > 0 {
+				o.Err = net.ErrClosed // peer went away meanwhile
+			}
+		default:
+			o.Err = err
+		}
+		outcomes = append(outcomes, o)
+	}
+
+	srv.closeClients()
+	srv.wgClients.Wait() // no more notifications after this
+	close(srv.monitorCh)
+	srv.wgMonitor.Wait()
+	if serr := srv.saveReplay(); serr != nil {
+		srv.log.Error("failed saving replay", "store", srv.replayStore, "err", serr)
+		if err == nil {
+			err = serr
+		}
+	}
+	for i, t := range ts {
+		outcomes[i].Bytes = t.c.BytesTransferred()
+	}
+	srv.log.Info("stopped serving")
+	return outcomes, err
+}
@@ -0,0 +1,86 @@
+package comm
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	srv := startServer(t)
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go io.Copy(ioutil.Discard, conn)
+	for srv.Status() != "1 client(s)" {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	outcomes, err := srv.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outcomes) != 1 || outcomes[0].Err != nil || outcomes[0].Pending != 0 {
+		t.Errorf("wanted 1 drained client, got %+v\n", outcomes)
+	}
+	if _, err := srv.Shutdown(ctx); err != ErrClosed {
+		t.Errorf("wanted %v, got %v\n", ErrClosed, err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	size := 1 << 16
+	stalled := func(srv *Server) bool { // feed blocked offering to the client
+		n := srv.Stats().Broadcasts
+		time.Sleep(20 * time.Millisecond)
+		return n > 0 && srv.Stats().Broadcasts == n
+	}
+	cases := []struct {
+		name  string
+		opt   Option
+		ready func(srv *Server) bool
+	}{
+		{"drop oldest", WithQueue(4, DropOldest), func(srv *Server) bool {
+			return srv.Drops() >= 64
+		}},
+		{"block", WithQueue(1, Block), stalled},
+	}
+	for _, c := range cases {
+		srv := NewServer("127.0.0.1:0", supplierMock(strings.Repeat("x", size)),
+			WithInterval(time.Millisecond), WithBufferSize(size), c.opt)
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for !c.ready(srv) { // not reading fills up socket buffers and the client's queue
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		outcomes, err := srv.Shutdown(ctx)
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: wanted shutdown by the deadline, took %s\n", c.name, d)
+		}
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s: wanted %v, got %v\n", c.name, context.DeadlineExceeded, err)
+		}
+		if len(outcomes) != 1 || outcomes[0].Err != context.DeadlineExceeded ||
+			outcomes[0].Pending == 0 {
+			t.Errorf("%s: wanted 1 forcibly closed client, got %+v\n", c.name, outcomes)
+		}
+		cancel()
+		conn.Close()
+	}
+}
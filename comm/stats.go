@@ -0,0 +1,79 @@
+package comm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// traffic counts data sent to clients.
+type traffic struct {
+	bytes uint64
+	msgs  uint64
+}
+
+// ClientStats is a snapshot of a client's statistics.
+type ClientStats struct {
+	Remote    string    `json:"remote"`
+	Connected time.Time `json:"connected"`
+	Bytes     uint64    `json:"bytes"`
+	Messages  uint64    `json:"messages"`
+	Queued    int       `json:"queued"`
+	Drops     uint64    `json:"drops"`
+	Topics    []string  `json:"topics,omitempty"`
+}
+
+// Stats is a snapshot of a server's statistics. Bytes and Messages count data
+// sent to all clients ever connected, Broadcasts and Supplied data received
+// from the suppliers.
+type Stats struct {
+	Started        time.Time         `json:"started"`
+	Uptime         time.Duration     `json:"uptime_ns"`
+	Broadcasts     uint64            `json:"broadcasts"`
+	Supplied       uint64            `json:"supplied_bytes"`
+	SupplierErrors uint64            `json:"supplier_errors"`
+	Bytes          uint64            `json:"bytes"`
+	Messages       uint64            `json:"messages"`
+	Drops          uint64            `json:"drops"`
+	BytesPerSec    float64           `json:"bytes_per_sec"`
+	MessagesPerSec float64           `json:"messages_per_sec"`
+	Rejected       map[string]uint64 `json:"rejected"`
+	Clients        []ClientStats     `json:"clients"`
+}
+
+// Stats returns the current statistics of the server.
+func (srv *Server) Stats() Stats {
+	srv.mu.Lock()
+	started := srv.started
+	srv.mu.Unlock()
+
+	st := Stats{
+		Started:        started,
+		Broadcasts:     atomic.LoadUint64(&srv.broadcasts),
+		Supplied:       atomic.LoadUint64(&srv.supplied),
+		SupplierErrors: atomic.LoadUint64(&srv.supplierErrors),
+		Bytes:          atomic.LoadUint64(&srv.total.bytes),
+		Messages:       atomic.LoadUint64(&srv.total.msgs),
+		Drops:          srv.Drops(),
+		Rejected:       srv.Rejected(),
+		Clients:        []ClientStats{},
+	}
+	if !started.IsZero() {
+		st.Uptime = time.Since(started)
+		if secs := st.Uptime.Seconds(); secs > 0 {
+			st.BytesPerSec = float64(st.Bytes) / secs
+			st.MessagesPerSec = float64(st.Messages) / secs
+		}
+	}
+	for _, t := range srv.targets() {
+		st.Clients = append(st.Clients, ClientStats{
+			Remote:    t.c.conn.RemoteAddr().String(),
+			Connected: t.c.since,
+			Bytes:     t.c.BytesTransferred(),
+			Messages:  t.c.MessagesTransferred(),
+			Queued:    len(t.dc.Out),
+			Drops:     t.c.Drops(),
+			Topics:    t.c.Topics(),
+		})
+	}
+	return st
+}
@@ -0,0 +1,260 @@
+package comm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kenix/gomad/util"
+)
+
+var (
+	ErrRetries = errors.New("comm: reconnect retries exhausted")
+	ErrTimeout = errors.New("comm: request timed out")
+)
+
+// RemoteError is the error message a server answered a request with.
+type RemoteError string
+
+func (e RemoteError) Error() string {
+	return "comm: server: " + string(e)
+}
+
+// Subscriber is the client side of a Server connection. It detects dead or
+// hung servers by a read timeout and reconnects transparently, requesting
+// replay of the frames missed meanwhile. A Subscriber must be read from one
+// goroutine only, requests may be issued from any goroutine.
+type Subscriber struct {
+	// Timeout is the time without any frame after which the connection is
+	// considered dead, should exceed the server's heartbeat interval. Zero
+	// disables timeout detection.
+	Timeout time.Duration
+	// Ping is the interval PING commands are sent in, for servers with read
+	// timeout. Zero disables pinging.
+	Ping time.Duration
+	// Retries limits the reconnect attempts per outage, zero means unlimited.
+	Retries int
+	// Backoff is the initial delay between reconnect attempts, doubled per
+	// attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Dial connects to the server, defaults to TCP.
+	Dial func(addr string) (net.Conn, error)
+	// Log defaults to the util loggers.
+	Log *slog.Logger
+
+	addr       string
+	cmds       []string
+	mu         sync.Mutex // guards conn, pinger, closed, id and calls
+	conn       net.Conn
+	pinger     chan util.Cue
+	closed     bool
+	id         uint64 // of the last request
+	calls      map[uint64]chan Frame
+	rd         *bufio.Reader
+	last       uint64 // sequence number of the last frame received
+	replaying  bool   // discarding data frames until the replay marker
+	reconnects int32
+}
+
+// NewSubscriber creates a subscriber for the server at addr sending cmds,
+// e.g. "SUB EURUSD", on every (re)connect. Call Connect before reading.
+func NewSubscriber(addr string, cmds ...string) *Subscriber {
+	return &Subscriber{addr: addr, cmds: cmds, calls: make(map[uint64]chan Frame),
+		Backoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second,
+		Log: defaultLogger.With("server", addr),
+		Dial: func(addr string) (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		}}
+}
+
+// Connect connects to the server, sends the subscriber's commands and, on
+// reconnect, requests replay of the frames missed.
+func (s *Subscriber) Connect() error {
+	conn, err := s.Dial(s.addr)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(conn)
+	for _, cmd := range s.cmds {
+		fmt.Fprintf(w, "%s\n", cmd)
+	}
+	if s.last > 0 {
+		fmt.Fprintf(w, "%s %d\n", CmdReplay, s.last+1)
+	}
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return ErrClosed
+	}
+	s.conn, s.rd, s.replaying = conn, bufio.NewReader(conn), s.last > 0
+	if s.Ping > 0 {
+		s.pinger = make(chan util.Cue)
+		go ping(conn, s.Ping, s.pinger)
+	}
+	return nil
+}
+
+func ping(conn net.Conn, d time.Duration, stop chan util.Cue) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprintf(conn, "%s\n", CmdPing); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Next returns the next data frame, reconnecting if the connection fails or
+// times out. Heartbeats are consumed silently, responses passed to the
+// pending requests.
+func (s *Subscriber) Next() (Frame, error) {
+	for {
+		if s.Timeout > 0 {
+			s.conn.SetReadDeadline(time.Now().Add(s.Timeout))
+		}
+		f, err := ReadFrame(s.rd)
+		if err != nil {
+			s.Log.Warn("lost connection", "err", err)
+			if err := s.reconnect(); err != nil {
+				return f, err
+			}
+			continue
+		}
+		switch f.Kind {
+		case KindReplay:
+			s.replaying = false
+			if f.Seq > s.last+1 {
+				s.Log.Warn("missed frames", "from", s.last+1, "to", f.Seq-1)
+			}
+		case KindResponse:
+			s.respond(f)
+		case KindData:
+			if s.replaying || f.Seq <= s.last {
+				continue
+			}
+			s.last = f.Seq
+			return f, nil
+		}
+	}
+}
+
+// Request sends cmd, e.g. "STATUS" or "SNAPSHOT EURUSD", as a request to the
+// server and waits up to timeout for the answer. Answers are received by
+// Next, which must be called meanwhile. A request is not repeated if the
+// connection fails.
+func (s *Subscriber) Request(cmd string, timeout time.Duration) ([]byte, error) {
+	s.mu.Lock()
+	if s.closed || s.conn == nil {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	s.id++
+	id, conn, ch := s.id, s.conn, make(chan Frame, 1)
+	s.calls[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.calls, id)
+		s.mu.Unlock()
+	}()
+
+	if _, err := fmt.Fprintf(conn, "%s %d %s\n", CmdRequest, id, cmd); err != nil {
+		return nil, err
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case f := <-ch:
+		if f.Topic == StatusError {
+			return nil, RemoteError(f.Data)
+		}
+		return f.Data, nil
+	case <-t.C:
+		return nil, ErrTimeout
+	}
+}
+
+func (s *Subscriber) respond(f Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.calls[f.Seq]; ok {
+		ch <- f
+		delete(s.calls, f.Seq)
+	} else {
+		s.Log.Warn("unexpected response", "id", f.Seq)
+	}
+}
+
+// Reconnects returns the number of successful reconnects.
+func (s *Subscriber) Reconnects() int {
+	return int(atomic.LoadInt32(&s.reconnects))
+}
+
+func (s *Subscriber) reconnect() error {
+	backoff := s.Backoff
+	for i := 0; s.Retries == 0 || i < s.Retries; i++ {
+		s.disconnect()
+		if s.isClosed() {
+			return ErrClosed
+		}
+		err := s.Connect()
+		if err == nil {
+			atomic.AddInt32(&s.reconnects, 1)
+			s.Log.Info("reconnected")
+			return nil
+		}
+		if err == ErrClosed {
+			return err
+		}
+		s.Log.Warn("failed reconnecting", "err", err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+	return ErrRetries
+}
+
+func (s *Subscriber) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Subscriber) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pinger != nil {
+		close(s.pinger)
+		s.pinger = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// Close closes the connection and stops reconnecting.
+func (s *Subscriber) Close() error {
+	s.disconnect()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
@@ -0,0 +1,116 @@
+package comm
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kenix/gomad/util"
+)
+
+func TestHeartbeat(t *testing.T) {
+	srv := startServer(t, WithPush(make(chan util.Cue)), WithHeartbeat(5*time.Millisecond))
+	defer srv.Stop()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 3; i++ {
+		f, err := ReadFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Kind != KindHeartbeat {
+			t.Errorf("wanted heartbeat, got %s\n", &f)
+		}
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	srv := startServer(t, WithReadTimeout(10*time.Millisecond))
+	defer srv.Stop()
+
+	for _, pinging := range []bool{true, false} {
+		s := NewSubscriber(srv.Addr().String())
+		s.Retries = 1
+		if pinging {
+			s.Ping = 2 * time.Millisecond
+		}
+		if err := s.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if got := srv.Status(); (got == "1 client(s)") != pinging {
+			t.Errorf("pinging %t: wanted connected %t, got %s\n", pinging, pinging, got)
+		}
+		s.Close()
+		for srv.Status() != "0 client(s)" {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestSubscriberReconnect(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "replay.sdb")
+	srv := startServer(t, WithReplay(1024), WithReplayStore(store))
+	addr := srv.Addr().String()
+	s := NewSubscriber(addr)
+	s.Backoff = time.Millisecond
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var last uint64
+	for i := 0; i < 4; i++ {
+		f, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last > 0 && f.Seq != last+1 {
+			t.Fatalf("wanted %d, got %d\n", last+1, f.Seq)
+		}
+		last = f.Seq
+		if i == 1 { // restart the server, frames broadcast meanwhile are replayed
+			srv.Stop()
+			srv = NewServer(addr, supplierMock("tick"), WithInterval(time.Millisecond),
+				WithReplay(1024), WithReplayStore(store))
+			if err := srv.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Stop()
+		}
+	}
+	if s.Reconnects() != 1 {
+		t.Errorf("wanted 1 reconnect, got %d\n", s.Reconnects())
+	}
+}
+
+func TestSubscriberTimeout(t *testing.T) {
+	for _, hb := range []time.Duration{0, 5 * time.Millisecond} {
+		srv := startServer(t, WithPush(make(chan util.Cue)), WithHeartbeat(hb))
+		s := NewSubscriber(srv.Addr().String())
+		s.Timeout, s.Backoff = 20*time.Millisecond, time.Millisecond
+		if err := s.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		errs := make(chan error)
+		go func() {
+			_, err := s.Next()
+			errs <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		if got := s.Reconnects(); (got > 0) != (hb == 0) {
+			t.Errorf("heartbeat %s: wanted reconnects %t, got %d\n", hb, hb == 0, got)
+		}
+		s.Close()
+		if err := <-errs; err != ErrClosed {
+			t.Errorf("wanted %v, got %v\n", ErrClosed, err)
+		}
+		srv.Stop()
+	}
+}
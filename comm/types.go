@@ -2,5 +2,5 @@ package comm
 
 type DualChan struct {
 	In  chan []byte
-	Out chan []byte
+	Out chan *Buffer
 }
@@ -0,0 +1,202 @@
+package comm
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+	sp "github.com/kenix/gomad/supplier"
+	"github.com/kenix/gomad/util"
+)
+
+// MaxDatagram is the maximum size of a UDP datagram's payload.
+const MaxDatagram = 65507
+
+// Publisher sends the data of a supplier as frames over UDP to a unicast or
+// multicast address. Each frame carries a sequence number, so receivers can
+// detect lost datagrams.
+type Publisher struct {
+	conn     *net.UDPConn
+	supplier sp.Source
+	interval time.Duration
+	seq      uint64
+	done     chan util.Cue
+	wg       sync.WaitGroup
+	Log      *slog.Logger // to be set before Start
+}
+
+// NewPublisher creates a publisher sending data of supplier polled every
+// interval to addr, e.g. "239.0.0.1:9999" for multicast.
+func NewPublisher(addr string, supplier sp.Supplier, interval time.Duration) (*Publisher, error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, ua)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Publisher{conn: conn, supplier: sp.AsSource(supplier), interval: interval,
+		done: make(chan util.Cue), Log: defaultLogger.With("addr", addr)}, nil
+}
+
+// Start starts polling the supplier and publishing its data until stopped or
+// the supplier is exhausted.
+func (p *Publisher) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		buf := bb.New(MaxDatagram - frameHeader)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				_, err := p.supplier.Supply(buf)
+				if buf.Flip().HasRemaining() {
+					if err := p.Publish("", buf.GetN(buf.Remaining())); err != nil {
+						p.Log.Error("failed publishing", "err", err)
+					}
+				}
+				buf.Clear()
+				switch {
+				case err == io.EOF:
+					p.Log.Info("supplier exhausted")
+					return
+				case err != nil:
+					p.Log.Warn("failed supplying", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// Publish sends dat under topic as the next frame.
+func (p *Publisher) Publish(topic string, dat []byte) error {
+	f := Frame{Kind: KindData, Seq: atomic.AddUint64(&p.seq, 1), Topic: topic, Data: dat}
+	if f.Len() > MaxDatagram {
+		return ErrFrame
+	}
+	_, err := p.conn.Write(f.Bytes())
+	return err
+}
+
+// Stop stops publishing and closes the underlying connection.
+func (p *Publisher) Stop() error {
+	close(p.done)
+	p.wg.Wait()
+	return p.conn.Close()
+}
+
+// restartWindow is how far sequence numbers may go back before a receiver
+// takes the publisher for restarted instead of the frames for late.
+const restartWindow = 1024
+
+// Receiver receives frames sent by a Publisher and detects gaps in their
+// sequence numbers.
+type Receiver struct {
+	conn  *net.UDPConn
+	buf   []byte
+	next  uint64
+	lost  uint64
+	gaps  uint64
+	late  uint64
+	OnGap func(from, to uint64) // called with the range of missing sequence numbers
+	Log   *slog.Logger
+}
+
+// Listen creates a receiver on addr, joining the group if addr is a multicast
+// address.
+func Listen(addr string) (*Receiver, error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn *net.UDPConn
+	if ua.IP != nil && ua.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", nil, ua)
+	} else {
+		conn, err = net.ListenUDP("udp", ua)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{conn: conn, buf: make([]byte, MaxDatagram),
+		Log: defaultLogger.With("addr", addr)}, nil
+}
+
+// Addr returns the local address of the receiver.
+func (r *Receiver) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Receive returns the next frame in sequence. Frames older than the last one
+// received are discarded as late or duplicate, unless the sequence starts
+// over at 1 or goes back more than restartWindow, i.e. the publisher
+// restarted. The frame's data is a copy owned by the caller, it is not
+// overwritten by subsequent receives.
+func (r *Receiver) Receive() (Frame, error) {
+	for {
+		n, err := r.conn.Read(r.buf)
+		if err != nil {
+			return Frame{}, err
+		}
+		f, _, err := DecodeFrame(r.buf[:n])
+		if err != nil {
+			r.Log.Warn("discarded datagram", "err", err)
+			continue
+		}
+		if r.next > 0 && f.Seq < r.next {
+			if f.Seq == 1 && r.next > 2 || r.next-f.Seq > restartWindow {
+				r.Log.Warn("publisher restarted", "seq", f.Seq, "expected", r.next)
+				r.next = 0
+			} else {
+				r.late++
+				continue
+			}
+		}
+		if r.next > 0 && f.Seq > r.next {
+			r.gaps++
+			r.lost += f.Seq - r.next
+			if r.OnGap != nil {
+				r.OnGap(r.next, f.Seq-1)
+			}
+		}
+		r.next = f.Seq + 1
+		return f, nil
+	}
+}
+
+// Lost returns the number of frames missed.
+func (r *Receiver) Lost() uint64 {
+	return r.lost
+}
+
+// Gaps returns the number of gaps detected.
+func (r *Receiver) Gaps() uint64 {
+	return r.gaps
+}
+
+// Late returns the number of late or duplicate frames discarded.
+func (r *Receiver) Late() uint64 {
+	return r.late
+}
+
+// SetDeadline sets the deadline for Receive.
+func (r *Receiver) SetDeadline(t time.Time) error {
+	return r.conn.SetReadDeadline(t)
+}
+
+// Close closes the receiver.
+func (r *Receiver) Close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,131 @@
+package comm
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPublisher(t *testing.T) {
+	r, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p, err := NewPublisher(r.Addr().String(), supplierMock("tick"), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	r.SetDeadline(time.Now().Add(time.Second))
+	for i := 0; i < 4; i++ {
+		f, err := r.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(f.Data) != "tick" {
+			t.Errorf("wanted tick, got %s\n", f.Data)
+		}
+	}
+}
+
+func TestReceiverGaps(t *testing.T) {
+	r, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var gaps [][2]uint64
+	r.OnGap = func(from, to uint64) {
+		gaps = append(gaps, [2]uint64{from, to})
+	}
+	conn, err := net.Dial("udp", r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, seq := range []uint64{1, 2, 5, 3, 6, 9} {
+		f := Frame{Kind: KindData, Seq: seq, Data: []byte(fmt.Sprint(seq))}
+		conn.Write(f.Bytes())
+	}
+	r.SetDeadline(time.Now().Add(time.Second))
+	var frames []Frame // held while receiving further frames
+	for _, want := range []uint64{1, 2, 5, 6, 9} {
+		f, err := r.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Seq != want {
+			t.Errorf("wanted %d, got %d\n", want, f.Seq)
+		}
+		frames = append(frames, f)
+	}
+	for _, f := range frames {
+		if string(f.Data) != fmt.Sprint(f.Seq) {
+			t.Errorf("wanted %d, got %s\n", f.Seq, f.Data)
+		}
+	}
+	if r.Gaps() != 2 || r.Lost() != 4 || r.Late() != 1 {
+		t.Errorf("wanted 2 gaps, 4 lost and 1 late, got %d, %d and %d\n",
+			r.Gaps(), r.Lost(), r.Late())
+	}
+	if len(gaps) != 2 || gaps[0] != [2]uint64{3, 4} || gaps[1] != [2]uint64{7, 8} {
+		t.Errorf("wanted [[3 4] [7 8]], got %v\n", gaps)
+	}
+}
+
+func TestReceiverRestart(t *testing.T) {
+	r, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	conn, err := net.Dial("udp", r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	seqs := []uint64{1, 2, 3, 1, 2, 5000, 3} // restarted twice
+	for _, seq := range seqs {
+		f := Frame{Kind: KindData, Seq: seq}
+		conn.Write(f.Bytes())
+	}
+	r.SetDeadline(time.Now().Add(time.Second))
+	for _, want := range seqs {
+		f, err := r.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Seq != want {
+			t.Errorf("wanted %d, got %d\n", want, f.Seq)
+		}
+	}
+	if r.Late() != 0 || r.Gaps() != 1 {
+		t.Errorf("wanted 0 late and 1 gap, got %d and %d\n", r.Late(), r.Gaps())
+	}
+}
+
+func TestMulticast(t *testing.T) {
+	r, err := Listen("239.255.42.99:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer r.Close()
+	_, port, _ := net.SplitHostPort(r.Addr().String())
+	p, err := NewPublisher(net.JoinHostPort("239.255.42.99", port), supplierMock("tick"), time.Millisecond)
+	if err != nil {
+		t.Skip(err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	r.SetDeadline(time.Now().Add(time.Second))
+	if _, err := r.Receive(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,289 @@
+package comm
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	bb "github.com/kenix/gomad/bytebuffer"
+)
+
+// WSMode denotes how frames are forwarded to WebSocket clients.
+type WSMode int
+
+const (
+	// WSBinary forwards frames as are in binary messages.
+	WSBinary WSMode = iota
+	// WSJSON forwards frames as JSON objects in text messages.
+	WSJSON
+)
+
+// WebSocket opcodes, see RFC 6455.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWSPayload limits messages received from WebSocket clients, which only
+// send commands.
+const maxWSPayload = 1 << 16
+
+var ErrWebSocket = errors.New("comm: websocket protocol error")
+
+// Attach adds conn as a client like an accepted connection, e.g. for
+// connections accepted elsewhere. It is screened and authenticated first, a
+// TLS connection completes its handshake. Returns ErrClosed if the server is
+// stopped, ErrRejected if screened out, ErrLimit if connection limits are
+// reached, the handshake or authentication error otherwise.
+func (srv *Server) Attach(conn net.Conn) error {
+	if reason := srv.screen(conn); reason != "" {
+		srv.reject(conn, reason, nil)
+		return ErrRejected
+	}
+	return srv.admit(conn)
+}
+
+// WebSocketHandler returns an http.Handler upgrading requests to WebSocket
+// connections, which are attached to the server as clients. Text or binary
+// messages from the client are taken as commands, e.g. "SUB EURUSD". Requests
+// from origins not allowed, see WithOrigins, are forbidden, connections are
+// screened before upgrading and authenticated after.
+func (srv *Server) WebSocketHandler(mode WSMode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if r.Method != http.MethodGet ||
+			!strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+			!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") ||
+			r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+			http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+			return
+		}
+		if !srv.allowedOrigin(r) {
+			srv.log.Warn("forbidden websocket origin", "remote", r.RemoteAddr,
+				"origin", r.Header.Get("Origin"))
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "websocket not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			srv.log.Error("failed hijacking", "remote", r.RemoteAddr, "err", err)
+			return
+		}
+		if reason := srv.screen(conn); reason != "" {
+			status := http.StatusForbidden
+			if reason == RejectRate {
+				status = http.StatusTooManyRequests
+			}
+			fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\nConnection: close\r\n\r\n",
+				status, http.StatusText(status))
+			rw.Flush()
+			srv.reject(conn, reason, nil)
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+		if err := rw.Flush(); err != nil {
+			conn.Close()
+			return
+		}
+		srv.log.Info("got websocket connection", "remote", addrOf(conn.RemoteAddr()))
+		srv.admit(&wsConn{Conn: conn, rd: rw.Reader, mode: mode, req: r})
+	})
+}
+
+// allowedOrigin returns true if r has no Origin header, or one of the origins
+// allowed, or the origin of r itself if none are configured.
+func (srv *Server) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(srv.origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, o := range srv.origins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeRequest returns the HTTP request conn was upgraded from if it is a
+// WebSocket connection, nil otherwise. Authenticators may check its headers,
+// e.g. cookies or tokens.
+func UpgradeRequest(conn net.Conn) *http.Request {
+	if c, ok := conn.(*wsConn); ok {
+		return c.req
+	}
+	return nil
+}
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// wsConn is a server side WebSocket connection. Each Write is sent as one
+// message and must hold a complete frame, Read returns the payload of
+// messages received, each terminated by a newline.
+type wsConn struct {
+	net.Conn
+	rd   *bufio.Reader
+	mode WSMode
+	req  *http.Request // upgraded from
+	wmu  sync.Mutex    // serializes writing messages
+	msg  []byte        // rest of the current message for reading
+}
+
+type wsFrame struct {
+	Kind  byte   `json:"kind"`
+	Seq   uint64 `json:"seq"`
+	Topic string `json:"topic,omitempty"`
+	Text  string `json:"text,omitempty"`
+	Data  []byte `json:"data,omitempty"` // base64 if not valid UTF-8
+}
+
+// ConnectionState returns the TLS state of the upgraded request, the zero
+// state if not over TLS.
+func (c *wsConn) ConnectionState() tls.ConnectionState {
+	if c.req.TLS == nil {
+		return tls.ConnectionState{}
+	}
+	return *c.req.TLS
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if c.mode == WSBinary {
+		if err := c.writeMessage(wsBinary, b); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	f, _, err := DecodeFrame(b)
+	if err != nil {
+		return 0, err
+	}
+	jf := wsFrame{Kind: f.Kind, Seq: f.Seq, Topic: f.Topic}
+	if utf8.Valid(f.Data) {
+		jf.Text = string(f.Data)
+	} else {
+		jf.Data = f.Data
+	}
+	dat, err := json.Marshal(jf)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.writeMessage(wsText, dat); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) writeMessage(op byte, payload []byte) error {
+	hdr := bb.New(2 + 8).OrderTo(binary.BigEndian)
+	hdr.Put(0x80 | op) // FIN
+	switch n := len(payload); {
+	case n < 126:
+		hdr.Put(byte(n))
+	case n <= 0xFFFF:
+		hdr.Put(126).PutUint16(uint16(n))
+	default:
+		hdr.Put(127).PutUint64(uint64(n))
+	}
+	hdr.Flip()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	bufs := net.Buffers{hdr.GetN(hdr.Remaining()), payload}
+	_, err := bufs.WriteTo(c.Conn)
+	return err
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for len(c.msg) == 0 {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case wsText, wsBinary, wsContinuation:
+			if len(payload) > 0 && payload[len(payload)-1] != '\n' {
+				payload = append(payload, '\n')
+			}
+			c.msg = payload
+		case wsPing:
+			if err := c.writeMessage(wsPong, payload); err != nil {
+				return 0, err
+			}
+		case wsClose:
+			c.writeMessage(wsClose, nil)
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, c.msg)
+	c.msg = c.msg[n:]
+	return n, nil
+}
+
+// readFrame reads one frame sent by the client, which must be masked.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(c.rd, hdr); err != nil {
+		return 0, nil, err
+	}
+	op, masked, n := hdr[0]&0x0F, hdr[1]&0x80 != 0, uint64(hdr[1]&0x7F)
+	if !masked {
+		return 0, nil, ErrWebSocket
+	}
+	switch n {
+	case 126, 127:
+		ext := make([]byte, 2+(n-126)*6)
+		if _, err := io.ReadFull(c.rd, ext); err != nil {
+			return 0, nil, err
+		}
+		buf := bb.Wrap(ext).OrderTo(binary.BigEndian)
+		if n == 126 {
+			n = uint64(buf.GetUint16())
+		} else {
+			n = buf.GetUint64()
+		}
+	}
+	if n > maxWSPayload {
+		return 0, nil, ErrWebSocket
+	}
+	dat := make([]byte, 4+n)
+	if _, err := io.ReadFull(c.rd, dat); err != nil {
+		return 0, nil, err
+	}
+	mask, payload := dat[:4], dat[4:]
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
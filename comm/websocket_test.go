@@ -0,0 +1,229 @@
+package comm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upgradeWS requests upgrading to a WebSocket connection at url with the
+// extra header lines given, returns the connection, a reader positioned after
+// the response and the response.
+func upgradeWS(t *testing.T, url string, header ...string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: "+key+"\r\nSec-WebSocket-Version: 13\r\n")
+	for _, h := range header {
+		io.WriteString(conn, h+"\r\n")
+	}
+	io.WriteString(conn, "\r\n")
+	rd := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := http.ReadResponse(rd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, rd, resp
+}
+
+// dialWS connects to a WebSocket endpoint of url, returns the connection and
+// a reader positioned after the handshake.
+func dialWS(t *testing.T, url string, header ...string) (net.Conn, *bufio.Reader) {
+	conn, rd, resp := upgradeWS(t, url, header...)
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("wanted upgrade, got %s %v\n", resp.Status, resp.Header)
+	}
+	return conn, rd
+}
+
+// readWS reads an unmasked message from the server.
+func readWS(t *testing.T, rd *bufio.Reader) (byte, []byte) {
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(rd, hdr); err != nil {
+		t.Fatal(err)
+	}
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(rd, ext)
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(rd, ext)
+		n = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(rd, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0F, payload
+}
+
+// writeWS writes a masked text message to the server.
+func writeWS(conn net.Conn, msg string) {
+	mask := []byte{1, 2, 3, 4}
+	b := append([]byte{0x80 | wsText, 0x80 | byte(len(msg))}, mask...)
+	for i := 0; i < len(msg); i++ {
+		b = append(b, msg[i]^mask[i%4])
+	}
+	conn.Write(b)
+}
+
+func TestWebSocketBinary(t *testing.T) {
+	srv := startServer(t)
+	defer srv.Stop()
+	hs := httptest.NewServer(srv.WebSocketHandler(WSBinary))
+	defer hs.Close()
+
+	conn, rd := dialWS(t, hs.URL)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	op, payload := readWS(t, rd)
+	f, _, err := DecodeFrame(payload)
+	if op != wsBinary || err != nil || string(f.Data) != "tick" {
+		t.Errorf("wanted binary tick, got %d %s: %v\n", op, &f, err)
+	}
+}
+
+func TestWebSocketJSON(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", nil, WithInterval(time.Millisecond),
+		WithTopic("a", supplierMock("A")))
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	hs := httptest.NewServer(srv.WebSocketHandler(WSJSON))
+	defer hs.Close()
+
+	conn, rd := dialWS(t, hs.URL)
+	defer conn.Close()
+	writeWS(conn, "SUB a")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	op, payload := readWS(t, rd)
+	var f wsFrame
+	if err := json.Unmarshal(payload, &f); err != nil {
+		t.Fatal(err)
+	}
+	if op != wsText || f.Kind != KindData || f.Topic != "a" || f.Text != "A" {
+		t.Errorf("wanted text a;A, got %d %s\n", op, payload)
+	}
+}
+
+func TestWebSocketBadRequest(t *testing.T) {
+	srv := NewServer("127.0.0.1:0", nil)
+	rec := httptest.NewRecorder()
+	srv.WebSocketHandler(WSBinary).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("wanted %d, got %d\n", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		origins []string
+		origin  string
+		want    int
+	}{
+		{nil, "", http.StatusSwitchingProtocols},
+		{nil, "http://localhost", http.StatusSwitchingProtocols},
+		{nil, "http://evil.example", http.StatusForbidden},
+		{[]string{"https://app.example"}, "https://app.example", http.StatusSwitchingProtocols},
+		{[]string{"https://app.example"}, "http://localhost", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		srv := startServer(t, WithOrigins(test.origins...))
+		hs := httptest.NewServer(srv.WebSocketHandler(WSBinary))
+		var header []string
+		if test.origin != "" {
+			header = append(header, "Origin: "+test.origin)
+		}
+		conn, _, resp := upgradeWS(t, hs.URL, header...)
+		if resp.StatusCode != test.want {
+			t.Errorf("%v %q: wanted %d, got %d\n", test.origins, test.origin, test.want, resp.StatusCode)
+		}
+		conn.Close()
+		hs.Close()
+		srv.Stop()
+	}
+}
+
+func TestWebSocketScreen(t *testing.T) {
+	srv := startServer(t, WithDeny("127.0.0.0/8"))
+	defer srv.Stop()
+	hs := httptest.NewServer(srv.WebSocketHandler(WSBinary))
+	defer hs.Close()
+
+	conn, _, resp := upgradeWS(t, hs.URL)
+	defer conn.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("wanted %d, got %d\n", http.StatusForbidden, resp.StatusCode)
+	}
+	if got := srv.Rejected()[RejectDenied]; got != 1 {
+		t.Errorf("wanted 1, got %d\n", got)
+	}
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	srv := startServer(t, WithAuth(func(conn net.Conn) error {
+		if r := UpgradeRequest(conn); r == nil || r.Header.Get("Authorization") != "Bearer secret" {
+			return ErrUnauthorized
+		}
+		return nil
+	}))
+	defer srv.Stop()
+	hs := httptest.NewServer(srv.WebSocketHandler(WSBinary))
+	defer hs.Close()
+
+	conn, rd := dialWS(t, hs.URL, "Authorization: Bearer secret")
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if op, _ := readWS(t, rd); op != wsBinary {
+		t.Errorf("wanted %d, got %d\n", wsBinary, op)
+	}
+
+	conn, rd = dialWS(t, hs.URL, "Authorization: Bearer guess")
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := rd.ReadByte(); err != io.EOF {
+		t.Errorf("wanted %v, got %v\n", io.EOF, err)
+	}
+	if got := srv.Rejected()[RejectAuth]; got != 1 {
+		t.Errorf("wanted 1, got %d\n", got)
+	}
+}
+
+func TestAttachScreen(t *testing.T) {
+	srv := startServer(t, WithDeny("127.0.0.0/8"))
+	defer srv.Stop()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Attach(conn); err != ErrRejected {
+		t.Errorf("wanted %v, got %v\n", ErrRejected, err)
+	}
+}
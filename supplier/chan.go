@@ -0,0 +1,21 @@
+package supplier
+
+// Chan is a push supplier of the data received from a channel, one per Get.
+// It stops when the channel is closed.
+type Chan struct {
+	pusher
+}
+
+// NewChan starts receiving data from ch.
+func NewChan(ch <-chan []byte) *Chan {
+	c := &Chan{pusher: newPusher()}
+	go func() {
+		defer c.finish(nil)
+		for dat := range ch {
+			if !c.push(dat) {
+				return
+			}
+		}
+	}()
+	return c
+}
@@ -0,0 +1,329 @@
+package supplier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kenix/gomad/util"
+)
+
+// TickFormat maps the fields of market data records to ticks. Fields are
+// named by CSV header or JSON key, by zero based column index for CSV
+// without header. A field left empty is absent from the records.
+type TickFormat struct {
+	Symbol, Time, Bid, Ask, Last, Volume string
+
+	Instrument string         // symbol of ticks without symbol field
+	TimeFormat string         // layout as of time.Parse or unix, unixms, unixus, unixns; RFC 3339 if empty
+	Location   *time.Location // of times without zone, UTC if nil
+	Comma      rune           // CSV field delimiter, ',' if 0
+	NoHeader   bool           // CSV has no header line
+	Speed      float64        // pacing by time, 1 at original speed, 0 or less as fast as taken
+}
+
+// DefaultTickFormat returns the format of records with fields symbol, time,
+// bid, ask, last and volume, time in RFC 3339, not paced.
+func DefaultTickFormat() TickFormat {
+	return TickFormat{Symbol: "symbol", Time: "time", Bid: "bid", Ask: "ask",
+		Last: "last", Volume: "volume"}
+}
+
+func (tf *TickFormat) fields() []string {
+	return []string{tf.Symbol, tf.Time, tf.Bid, tf.Ask, tf.Last, tf.Volume}
+}
+
+// tick parses a tick from the field values in the order of fields, empty
+// for fields absent.
+func (tf *TickFormat) tick(vals []string) (Tick, error) {
+	t := Tick{Symbol: tf.Instrument}
+	var err error
+	if vals[0] != "" {
+		t.Symbol = vals[0]
+	}
+	if len(t.Symbol) > MaxSymbolLength {
+		return t, fmt.Errorf("symbol of %d byte(s)", len(t.Symbol))
+	}
+	if vals[1] != "" {
+		if t.Time, err = tf.parseTime(vals[1]); err != nil {
+			return t, err
+		}
+	}
+	for i, p := range []*float64{&t.Bid, &t.Ask, &t.Last} {
+		if vals[2+i] == "" {
+			continue
+		}
+		if *p, err = strconv.ParseFloat(vals[2+i], 64); err != nil {
+			return t, err
+		}
+	}
+	if vals[5] != "" {
+		if t.Volume, err = strconv.ParseUint(vals[5], 10, 64); err != nil {
+			v, ferr := strconv.ParseFloat(vals[5], 64)
+			if ferr != nil || v < 0 || v > math.MaxUint64 {
+				return t, err
+			}
+			t.Volume = uint64(v)
+		}
+	}
+	return t, nil
+}
+
+var unixUnits = map[string]time.Duration{"unix": time.Second,
+	"unixms": time.Millisecond, "unixus": time.Microsecond, "unixns": time.Nanosecond}
+
+func (tf *TickFormat) parseTime(s string) (time.Time, error) {
+	if unit, ok := unixUnits[tf.TimeFormat]; ok {
+		return parseUnix(s, unit)
+	}
+	layout, loc := tf.TimeFormat, tf.Location
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// parseUnix parses a decimal number of units since epoch, without losing
+// precision of fractions down to nanoseconds.
+func parseUnix(s string, unit time.Duration) (time.Time, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var ns int64
+	for i, scale := 0, int64(unit)/10; i < len(frac) && scale > 0; i, scale = i+1, scale/10 {
+		if frac[i] < '0' || frac[i] > '9' {
+			return time.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		ns += int64(frac[i]-'0') * scale
+	}
+	if strings.HasPrefix(whole, "-") {
+		ns = -ns
+	}
+	return time.Unix(0, n*int64(unit)+ns), nil
+}
+
+// Ticks is a push supplier of the ticks parsed from CSV or JSON Lines market
+// data, one encoded tick per Get. Malformed records are skipped. It stops at
+// the end of input.
+type Ticks struct {
+	pusher
+	format      TickFormat
+	base, start time.Time // of pacing
+	skipped     uint64
+}
+
+// NewCSVTicks starts parsing ticks from CSV read from r.
+func NewCSVTicks(r io.Reader, tf TickFormat) *Ticks {
+	ts := &Ticks{pusher: newPusher(), format: tf}
+	go ts.csv(r)
+	return ts
+}
+
+// NewJSONTicks starts parsing ticks from JSON Lines read from r, one object
+// per line.
+func NewJSONTicks(r io.Reader, tf TickFormat) *Ticks {
+	ts := &Ticks{pusher: newPusher(), format: tf}
+	go ts.json(r)
+	return ts
+}
+
+// OpenTicks starts parsing ticks from the file at path, JSON Lines if ending
+// with .jsonl or .ndjson, CSV otherwise, closing it at the end.
+func OpenTicks(path string, tf TickFormat) (*Ticks, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ts := &Ticks{pusher: newPusher(), format: tf}
+	go func() {
+		defer f.Close()
+		switch filepath.Ext(path) {
+		case ".jsonl", ".ndjson":
+			ts.json(f)
+		default:
+			ts.csv(f)
+		}
+	}()
+	return ts, nil
+}
+
+func (ts *Ticks) csv(r io.Reader) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	if ts.format.Comma != 0 {
+		cr.Comma = ts.format.Comma
+	}
+	cols := make([]int, len(ts.format.fields()))
+	var header map[string]int
+	if !ts.format.NoHeader {
+		rec, err := cr.Read()
+		if err != nil {
+			ts.end(err)
+			return
+		}
+		header = make(map[string]int, len(rec))
+		for i, name := range rec {
+			header[strings.TrimSpace(name)] = i
+		}
+	}
+	for i, name := range ts.format.fields() {
+		cols[i] = -1
+		if name == "" {
+			continue
+		}
+		var ok bool
+		if header != nil {
+			cols[i], ok = header[name]
+		} else {
+			var err error
+			cols[i], err = strconv.Atoi(name)
+			ok = err == nil && cols[i] >= 0
+		}
+		if !ok {
+			ts.end(fmt.Errorf("no column %q", name))
+			return
+		}
+	}
+	vals := make([]string, len(cols))
+	for {
+		rec, err := cr.Read()
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				ts.skip(err)
+				continue
+			}
+			ts.end(err)
+			return
+		}
+		for i, c := range cols {
+			vals[i] = ""
+			if c >= 0 && c < len(rec) {
+				vals[i] = strings.TrimSpace(rec[c])
+			}
+		}
+		if line, _ := cr.FieldPos(0); !ts.parsed(vals, line) {
+			ts.end(nil)
+			return
+		}
+	}
+}
+
+func (ts *Ticks) json(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	fields := ts.format.fields()
+	vals := make([]string, len(fields))
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			ts.skip(fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		var err error
+		for i, name := range fields {
+			if vals[i], err = jsonValue(obj[name]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			ts.skip(fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		if !ts.parsed(vals, line) {
+			ts.end(nil)
+			return
+		}
+	}
+	ts.end(scanner.Err())
+}
+
+// jsonValue returns the text of a JSON string or number, empty for null or
+// absent.
+func jsonValue(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+// parsed pushes the tick of vals parsed from line once due, returns false
+// if the supplier was closed meanwhile.
+func (ts *Ticks) parsed(vals []string, line int) bool {
+	t, err := ts.format.tick(vals)
+	if err != nil {
+		ts.skip(fmt.Errorf("line %d: %w", line, err))
+		return true
+	}
+	return ts.pace(t.Time) && ts.push(t.Bytes())
+}
+
+// pace waits until a tick of time tm is due, the first tick is due right
+// away. It returns false if the supplier was closed meanwhile.
+func (ts *Ticks) pace(tm time.Time) bool {
+	if ts.format.Speed <= 0 || tm.IsZero() {
+		return true
+	}
+	if ts.base.IsZero() {
+		ts.base, ts.start = tm, time.Now()
+		return true
+	}
+	due := ts.start.Add(time.Duration(float64(tm.Sub(ts.base)) / ts.format.Speed))
+	select {
+	case <-time.After(time.Until(due)):
+		return true
+	case <-ts.done:
+		return false
+	}
+}
+
+func (ts *Ticks) skip(err error) {
+	atomic.AddUint64(&ts.skipped, 1)
+	util.Lw.Printf("skipped tick: %s\n", err)
+}
+
+func (ts *Ticks) end(err error) {
+	if err != nil && err != io.EOF {
+		util.Le.Printf("failed reading ticks: %s\n", err)
+	} else {
+		err = nil
+	}
+	ts.finish(err)
+}
+
+// Skipped returns the number of malformed records skipped so far.
+func (ts *Ticks) Skipped() uint64 {
+	return atomic.LoadUint64(&ts.skipped)
+}
+
+// Err returns the error parsing stopped with, nil if stopped at the end or
+// still parsing.
+func (ts *Ticks) Err() error {
+	return ts.failure()
+}
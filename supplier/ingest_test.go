@@ -0,0 +1,141 @@
+package supplier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ticks returns the ticks supplied by ts until it stops.
+func ticks(t *testing.T, ts *Ticks) []string {
+	var got []string
+	for _, dat := range get(ts, 1<<20) {
+		tick, _, err := DecodeTick([]byte(dat))
+		if err != nil {
+			t.Fatalf("failed decoding %q: %s\n", dat, err)
+		}
+		got = append(got, tick.String())
+	}
+	return got
+}
+
+func TestTicks(t *testing.T) {
+	layout := TickFormat{Time: "0", Bid: "1", Ask: "2", Instrument: "EURUSD",
+		TimeFormat: "2006.01.02 15:04:05.000", Location: time.FixedZone("EET", 2*3600),
+		Comma: ';', NoHeader: true}
+	missing := DefaultTickFormat()
+	missing.Volume = "size"
+
+	cases := []struct {
+		name   string
+		ts     *Ticks
+		want   []string
+		skip   uint64
+		failed bool
+	}{
+		{"csv", NewCSVTicks(strings.NewReader(
+			"symbol,time,bid,ask,last,volume\n"+
+				"EURUSD,2026-01-02T03:04:05.123456789Z,1.085,1.086,1.086,100000\n"+
+				"USDJPY,2026-01-02T03:04:06Z,157.1,157.2,,2e6\n"+
+				"USDJPY,yesterday,157.1,157.2,,1\n"+
+				"EURUSD,,1.084,,,\n"), DefaultTickFormat()),
+			[]string{
+				"EURUSD 1.08500 1.08600 1.08600 100000 2026-01-02T03:04:05.123456789Z",
+				"USDJPY 157.10000 157.20000 0.00000 2000000 2026-01-02T03:04:06Z",
+				"EURUSD 1.08400 0.00000 0.00000 0 0001-01-01T00:00:00Z",
+			}, 1, false},
+		{"layout", NewCSVTicks(strings.NewReader(
+			"2026.01.02 05:04:05.500;1.085;1.086\n"+
+				"2026.01.02 05:04:06.000;1.084\n"), layout),
+			[]string{
+				"EURUSD 1.08500 1.08600 0.00000 0 2026-01-02T03:04:05.5Z",
+				"EURUSD 1.08400 0.00000 0.00000 0 2026-01-02T03:04:06Z",
+			}, 0, false},
+		{"missing column", NewCSVTicks(strings.NewReader(
+			"symbol,time,bid,ask,last,volume\n"), missing), nil, 0, true},
+		{"jsonl", NewJSONTicks(strings.NewReader(
+			`{"sym":"EURUSD","ts":1767323045.25,"bid":1.085,"ask":"1.086"}`+"\n\n"+
+				`{"sym":"EURUSD","ts":"1767323046","bid":1.084,"ask":1.085,"qty":300}`+"\n"+
+				`{"sym":"EURUSD","ts":true}`+"\n"+
+				`not json`+"\n"), TickFormat{Symbol: "sym", Time: "ts", Bid: "bid",
+			Ask: "ask", Volume: "qty", TimeFormat: "unix"}),
+			[]string{
+				"EURUSD 1.08500 1.08600 0.00000 0 2026-01-02T03:04:05.25Z",
+				"EURUSD 1.08400 1.08500 0.00000 300 2026-01-02T03:04:06Z",
+			}, 2, false},
+	}
+	for _, c := range cases {
+		got := ticks(t, c.ts)
+		if strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("%s: wanted %q, got %q\n", c.name, c.want, got)
+		}
+		if c.ts.Skipped() != c.skip {
+			t.Errorf("%s: wanted %d skipped, got %d\n", c.name, c.skip, c.ts.Skipped())
+		}
+		if (c.ts.Err() != nil) != c.failed {
+			t.Errorf("%s: wanted failed %t, got %v\n", c.name, c.failed, c.ts.Err())
+		}
+	}
+}
+
+func TestParseUnix(t *testing.T) {
+	cases := []struct {
+		s    string
+		unit time.Duration
+		want int64
+	}{
+		{"1767323045", time.Second, 1767323045e9},
+		{"1767323045.123456789123", time.Second, 1767323045123456789},
+		{"1767323045123.5", time.Millisecond, 1767323045123500000},
+		{"-1.5", time.Second, -15e8},
+		{"42", time.Nanosecond, 42},
+	}
+	for _, c := range cases {
+		got, err := parseUnix(c.s, c.unit)
+		if err != nil || got.UnixNano() != c.want {
+			t.Errorf("%s: wanted %d, got %d, %v\n", c.s, c.want, got.UnixNano(), err)
+		}
+	}
+	if _, err := parseUnix("1.5e3", time.Second); err == nil {
+		t.Errorf("wanted error, got nil\n")
+	}
+}
+
+func TestTicksPaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticks.jsonl")
+	dat := `{"symbol":"EURUSD","time":"2026-01-02T03:04:05Z","bid":1}` + "\n" +
+		`{"symbol":"EURUSD","time":"2026-01-02T03:04:05.2Z","bid":2}` + "\n"
+	if err := os.WriteFile(path, []byte(dat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tf := DefaultTickFormat()
+	tf.Speed = 2
+	ts, err := OpenTicks(path, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if got := ticks(t, ts); len(got) != 2 {
+		t.Errorf("wanted 2 ticks, got %q\n", got)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("wanted about 100ms, got %s\n", elapsed)
+	}
+
+	tf.Speed = 1e-3
+	ts, _ = OpenTicks(path, tf)
+	done := make(chan []string)
+	go func() { done <- ticks(t, ts) }()
+	time.Sleep(10 * time.Millisecond)
+	ts.Close()
+	select {
+	case got := <-done:
+		if len(got) != 1 {
+			t.Errorf("wanted 1 tick before closing, got %q\n", got)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("wanted closing to stop pacing\n")
+	}
+}
@@ -0,0 +1,532 @@
+package supplier
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/util"
+)
+
+// The combinators below wrap suppliers into sources, which also implement
+// Notifier if the wrapped supplier does, so that feeds can be assembled
+// before being handed to a server, e.g.
+//
+//	Throttle(Filter(Multiplex(a, b), keep), 1<<20, 1<<16)
+//
+// They implement io.Closer, closing the wrapped suppliers which do.
+
+// notifying is a source pushing data of its notifier.
+type notifying struct {
+	Source
+	Notifier
+}
+
+func (n notifying) Close() error {
+	return closeSupplier(n.Source)
+}
+
+// closeSupplier closes s if it is an io.Closer, also if adapted by AsSource.
+func closeSupplier(s Supplier) error {
+	if a, ok := s.(source); ok {
+		s = a.Supplier
+	}
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// wrap returns src, implementing Notifier as well if s does.
+func wrap(s Supplier, src Source) Source {
+	if n, ok := s.(Notifier); ok {
+		return notifying{src, n}
+	}
+	return src
+}
+
+// scratch returns b cleared and limited to n bytes, reallocated if too small.
+func scratch(b bytebuffer.ByteBuffer, n int) bytebuffer.ByteBuffer {
+	if n < 0 {
+		n = 0
+	}
+	if b == nil || b.Capacity() < n {
+		b = bytebuffer.New(n)
+	}
+	return b.Clear().LimitTo(n)
+}
+
+// mux multiplexes sources. Pushing sources may cue once for several data and
+// data may be taken without a cue, so the mux cues again as long as data is
+// supplied, and after all notifiers closed until all sources are exhausted.
+type mux struct {
+	all    []Source
+	srcs   []Source // not exhausted
+	next   int
+	notify chan util.Cue // nil if polled
+	retry  chan util.Cue // asks for another cue
+	quiet  chan util.Cue // closed once all notifiers are closed
+	ended  chan util.Cue // closed once all sources are exhausted
+	done   chan util.Cue
+	once   sync.Once
+	end    sync.Once
+}
+
+// Multiplex supplies the data of all ss in turn, one per call, skipping
+// those without data. It is exhausted once all ss are. If all ss push data,
+// so does the result until all ss are exhausted, otherwise pushing ss are
+// polled.
+func Multiplex(ss ...Supplier) Source {
+	m := &mux{all: make([]Source, len(ss)), done: make(chan util.Cue)}
+	pushing := len(ss) > 0
+	for i, s := range ss {
+		m.all[i] = AsSource(s)
+		_, ok := s.(Notifier)
+		pushing = pushing && ok
+	}
+	m.srcs = append([]Source(nil), m.all...)
+	if !pushing {
+		return m
+	}
+	m.notify, m.retry = make(chan util.Cue), make(chan util.Cue, 1)
+	m.quiet, m.ended = make(chan util.Cue), make(chan util.Cue)
+	var wg sync.WaitGroup
+	for _, s := range ss {
+		wg.Add(1)
+		go func(n <-chan util.Cue) {
+			defer wg.Done()
+			for {
+				select {
+				case _, ok := <-n:
+					if !ok {
+						return
+					}
+					m.again()
+				case <-m.done:
+					return
+				}
+			}
+		}(s.(Notifier).Notify())
+	}
+	go func() {
+		wg.Wait()
+		close(m.quiet)
+	}()
+	go m.relay()
+	return notifying{m, m}
+}
+
+// relay passes on the cues asked for, plus one once all notifiers closed,
+// until all sources are exhausted or the mux is closed.
+func (m *mux) relay() {
+	defer close(m.notify)
+	quiet := m.quiet
+	for {
+		select {
+		case <-m.retry:
+		case <-quiet: // data may be left
+			quiet = nil
+		case <-m.ended:
+			return
+		case <-m.done:
+			return
+		}
+		select {
+		case m.notify <- util.Cue{}:
+		case <-m.ended:
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// again asks for another cue, unless one is asked for already.
+func (m *mux) again() {
+	select {
+	case m.retry <- util.Cue{}:
+	default:
+	}
+}
+
+func (m *mux) Get(buf bytebuffer.ByteBuffer) {
+	m.Supply(buf)
+}
+
+func (m *mux) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	n, err := m.supply(buf)
+	if m.notify != nil {
+		if len(m.srcs) == 0 {
+			m.end.Do(func() { close(m.ended) })
+		} else if n > 0 { // more may be left
+			m.again()
+		}
+	}
+	return n, err
+}
+
+func (m *mux) supply(buf bytebuffer.ByteBuffer) (int, error) {
+	for tries := len(m.srcs); tries > 0 && len(m.srcs) > 0; tries-- {
+		m.next %= len(m.srcs)
+		n, err := m.srcs[m.next].Supply(buf)
+		if err == io.EOF || err != nil && m.isQuiet() { // no more data
+			m.srcs = append(m.srcs[:m.next], m.srcs[m.next+1:]...)
+			if err != io.EOF {
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		m.next++
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	if len(m.srcs) == 0 {
+		return 0, io.EOF
+	}
+	return 0, nil
+}
+
+// isQuiet denotes if all notifiers are closed, i.e. pushing sources failing
+// now fail for good.
+func (m *mux) isQuiet() bool {
+	select {
+	case <-m.quiet:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *mux) Notify() <-chan util.Cue {
+	return m.notify
+}
+
+// Close closes all multiplexed suppliers, then waits until the notify channel
+// is closed.
+func (m *mux) Close() error {
+	m.once.Do(func() { close(m.done) })
+	var err error
+	for _, src := range m.all {
+		if cerr := closeSupplier(src); err == nil {
+			err = cerr
+		}
+	}
+	if m.notify != nil {
+		for range m.notify { // cues of data left
+		}
+	}
+	return err
+}
+
+// bucket is a token bucket refilled at rate tokens per second up to burst.
+// Tokens may be overdrawn, delaying the next ones.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// wait returns how long until a token is available.
+func (b *bucket) wait(now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens >= 1 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take(n int) {
+	b.tokens -= float64(n)
+}
+
+// limiter supplies data of its source within the budget of its bucket. The
+// source isn't asked without budget left. Pushed data is held back meanwhile,
+// a cue is sent once there is budget again.
+type limiter struct {
+	src    Source
+	b      *bucket
+	cost   func(n int) int
+	notify chan util.Cue // cues of pushed data, nil if polled
+	retry  chan util.Cue // asks for another cue
+	ended  chan util.Cue // closed once the source returned an error
+	done   chan util.Cue
+	once   sync.Once
+	end    sync.Once
+}
+
+func newLimiter(s Supplier, rate float64, burst int, cost func(n int) int) Source {
+	l := &limiter{src: AsSource(s), b: newBucket(rate, burst), cost: cost,
+		done: make(chan util.Cue)}
+	n, ok := s.(Notifier)
+	if !ok {
+		return l
+	}
+	l.notify, l.retry, l.ended = make(chan util.Cue), make(chan util.Cue, 1), make(chan util.Cue)
+	go l.forward(n.Notify())
+	return notifying{l, l}
+}
+
+// forward passes on the cues of n and those asked for by again, until the
+// source returned an error after n was closed, or the limiter is closed.
+func (l *limiter) forward(n <-chan util.Cue) {
+	defer close(l.notify)
+	ended := l.ended
+	for n != nil || ended != nil {
+		select {
+		case _, ok := <-n:
+			if !ok {
+				n = nil
+				continue
+			}
+		case <-ended:
+			ended = nil
+			continue
+		case <-l.retry:
+		case <-l.done:
+			return
+		}
+		select {
+		case l.notify <- util.Cue{}:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// again asks for another cue, unless one is asked for already.
+func (l *limiter) again() {
+	select {
+	case l.retry <- util.Cue{}:
+	default:
+	}
+}
+
+func (l *limiter) Get(buf bytebuffer.ByteBuffer) {
+	l.Supply(buf)
+}
+
+func (l *limiter) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	if d := l.b.wait(time.Now()); d > 0 {
+		if l.notify != nil {
+			time.AfterFunc(d, l.again)
+		}
+		return 0, nil
+	}
+	n, err := l.src.Supply(buf)
+	l.b.take(l.cost(n))
+	if l.notify != nil {
+		if err != nil {
+			l.end.Do(func() { close(l.ended) })
+		} else if n > 0 { // more may have been pushed before n was closed
+			l.again()
+		}
+	}
+	return n, err
+}
+
+func (l *limiter) Notify() <-chan util.Cue {
+	return l.notify
+}
+
+// Close closes the limited supplier, then waits until the notify channel is
+// closed.
+func (l *limiter) Close() error {
+	l.once.Do(func() { close(l.done) })
+	err := closeSupplier(l.src)
+	if l.notify != nil {
+		for range l.notify { // cues of data left
+		}
+	}
+	return err
+}
+
+// RateLimit supplies at most rate data of s per second, allowing bursts of
+// burst data. Polled suppliers are not asked without a token left, pushed
+// data is held back until there is one.
+func RateLimit(s Supplier, rate float64, burst int) Source {
+	return newLimiter(s, rate, burst, func(n int) int {
+		if n > 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Throttle supplies at most rate bytes of s per second, allowing bursts of
+// burst bytes. Data exceeding the budget is supplied, but delays the next.
+// Polled suppliers are not asked without budget left, pushed data is held
+// back until there is.
+func Throttle(s Supplier, rate float64, burst int) Source {
+	return newLimiter(s, rate, burst, func(n int) int { return n })
+}
+
+type transform struct {
+	src Source
+	f   func(dat []byte) []byte
+	tmp bytebuffer.ByteBuffer
+}
+
+// Transform supplies the data of s as transformed by f, dropping the data
+// if f returns nil.
+func Transform(s Supplier, f func(dat []byte) []byte) Source {
+	return wrap(s, &transform{src: AsSource(s), f: f})
+}
+
+// Filter supplies the data of s that keep returns true for.
+func Filter(s Supplier, keep func(dat []byte) bool) Source {
+	return Transform(s, func(dat []byte) []byte {
+		if keep(dat) {
+			return dat
+		}
+		return nil
+	})
+}
+
+func (t *transform) Get(buf bytebuffer.ByteBuffer) {
+	t.Supply(buf)
+}
+
+func (t *transform) Close() error {
+	return closeSupplier(t.src)
+}
+
+func (t *transform) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	t.tmp = scratch(t.tmp, buf.Remaining())
+	n, err := t.src.Supply(t.tmp)
+	if n == 0 {
+		return 0, err
+	}
+	dat := t.f(t.tmp.Flip().GetN(n))
+	if len(dat) > buf.Remaining() {
+		return 0, bytebuffer.ErrOverflow
+	}
+	buf.PutN(dat)
+	return len(dat), err
+}
+
+type tee struct {
+	src    Source
+	record func(dat []byte) error
+}
+
+// Tee supplies the data of s, passing it to record as well, e.g. to write it
+// into a comm.RecordWriter. Errors recording are returned along with the
+// data.
+func Tee(s Supplier, record func(dat []byte) error) Source {
+	return wrap(s, &tee{src: AsSource(s), record: record})
+}
+
+func (t *tee) Get(buf bytebuffer.ByteBuffer) {
+	t.Supply(buf)
+}
+
+func (t *tee) Close() error {
+	return closeSupplier(t.src)
+}
+
+func (t *tee) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	p := buf.Position()
+	n, err := t.src.Supply(buf)
+	if n > 0 {
+		if rerr := t.record(buf.PositionTo(p).GetN(n)); err == nil {
+			err = rerr
+		}
+	}
+	return n, err
+}
+
+type batch struct {
+	src  Source
+	max  int
+	tmp  bytebuffer.ByteBuffer
+	held []byte // data not fitting into the last batch
+	err  error  // supplied along with held
+}
+
+// Batch supplies up to max data of s at once, each prefixed by its length as
+// 32 bit unsigned integer in network byte order. Batches are formed of the
+// data available without waiting. Split splits batches again.
+func Batch(s Supplier, max int) Source {
+	return wrap(s, &batch{src: AsSource(s), max: max})
+}
+
+func (b *batch) Get(buf bytebuffer.ByteBuffer) {
+	b.Supply(buf)
+}
+
+func (b *batch) Close() error {
+	return closeSupplier(b.src)
+}
+
+func (b *batch) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	written, count := 0, 0
+	put := func(dat []byte) bool {
+		if 4+len(dat) > buf.Remaining() {
+			return false
+		}
+		buf.PutN(binary.BigEndian.AppendUint32(nil, uint32(len(dat)))).PutN(dat)
+		written += 4 + len(dat)
+		count++
+		return true
+	}
+	if b.held != nil {
+		dat, err := b.held, b.err
+		b.held, b.err = nil, nil
+		if !put(dat) {
+			return 0, bytebuffer.ErrOverflow
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	size := buf.Remaining() - 4 // fits into an empty batch at least
+	for count < b.max {
+		b.tmp = scratch(b.tmp, size)
+		n, err := b.src.Supply(b.tmp)
+		if n > 0 && !put(b.tmp.Flip().GetN(n)) {
+			b.held, b.err = b.tmp.PositionTo(0).GetN(n), err
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return written, nil
+}
+
+// Split returns the data of a batch.
+func Split(batch []byte) ([][]byte, error) {
+	var dats [][]byte
+	for len(batch) > 0 {
+		if len(batch) < 4 {
+			return dats, io.ErrUnexpectedEOF
+		}
+		n := binary.BigEndian.Uint32(batch)
+		if uint32(len(batch)-4) < n {
+			return dats, io.ErrUnexpectedEOF
+		}
+		dats = append(dats, batch[4:4+n])
+		batch = batch[4+n:]
+	}
+	return dats, nil
+}
@@ -0,0 +1,213 @@
+package supplier
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/util"
+)
+
+// items is a polled source of its data, exhausted after the last.
+type items []string
+
+func (it *items) Get(buf bytebuffer.ByteBuffer) {
+	it.Supply(buf)
+}
+
+func (it *items) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	if len(*it) == 0 {
+		return 0, io.EOF
+	}
+	dat := (*it)[0]
+	*it = (*it)[1:]
+	buf.PutN([]byte(dat))
+	if len(*it) == 0 {
+		return len(dat), io.EOF
+	}
+	return len(dat), nil
+}
+
+func newItems(dats ...string) *items {
+	it := items(dats)
+	return &it
+}
+
+// supplyAll returns what src supplies per call until exhausted, n at most.
+func supplyAll(src Source, n int) []string {
+	var got []string
+	buf := bytebuffer.New(64)
+	for i := 0; i < n; i++ {
+		k, err := src.Supply(buf)
+		if k > 0 {
+			got = append(got, string(buf.Flip().GetN(k)))
+		}
+		buf.Clear()
+		if err != nil {
+			break
+		}
+	}
+	return got
+}
+
+func pushed(dats ...string) Supplier {
+	ch := make(chan []byte, len(dats))
+	for _, dat := range dats {
+		ch <- []byte(dat)
+	}
+	close(ch)
+	return NewChan(ch)
+}
+
+// cued pushes its items, cueing once only for all of them.
+type cued struct {
+	*items
+	notify chan util.Cue
+}
+
+func (c cued) Notify() <-chan util.Cue {
+	return c.notify
+}
+
+func newCued(dats ...string) cued {
+	notify := make(chan util.Cue, 1)
+	notify <- util.Cue{}
+	close(notify)
+	return cued{newItems(dats...), notify}
+}
+
+func TestMiddleware(t *testing.T) {
+	var recorded []string
+	record := func(dat []byte) error {
+		recorded = append(recorded, string(dat))
+		return nil
+	}
+	single := func(dat []byte) bool { return len(dat) == 1 }
+
+	cases := []struct {
+		name string
+		src  Source
+		want []string
+	}{
+		{"multiplex", Multiplex(newItems("a", "b", "c"), getter("x"), newItems("1")),
+			[]string{"a", "x", "1", "b", "x", "c", "x", "x"}},
+		{"multiplex exhausted", Multiplex(newItems("a"), newItems("b", "c")), []string{"a", "b", "c"}},
+		{"rate limit", RateLimit(getter("a"), 1, 2), []string{"a", "a"}},
+		{"throttle", Throttle(getter("abcd"), 1, 10), []string{"abcd", "abcd", "abcd"}},
+		{"filter", Filter(newItems("a", "bb", "c"), single), []string{"a", "c"}},
+		{"transform", Transform(newItems("a", "b"), bytes.ToUpper), []string{"A", "B"}},
+		{"tee", Tee(newItems("a", "b"), record), []string{"a", "b"}},
+		{"batch", Batch(newItems("a", "bb", "ccc"), 2), []string{"\x00\x00\x00\x01a\x00\x00\x00\x02bb",
+			"\x00\x00\x00\x03ccc"}},
+	}
+	for _, c := range cases {
+		if got := supplyAll(c.src, 8); strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: wanted %q, got %q\n", c.name, c.want, got)
+		}
+	}
+	if strings.Join(recorded, ",") != "a,b" {
+		t.Errorf("wanted a and b recorded, got %v\n", recorded)
+	}
+}
+
+func TestMiddlewarePushed(t *testing.T) {
+	upper := func(dat []byte) []byte { return bytes.ToUpper(dat) }
+	cases := []struct {
+		name string
+		s    Supplier
+		want []string
+	}{
+		{"multiplex", Multiplex(pushed("a", "b"), pushed("c")), []string{"a", "b", "c"}},
+		{"multiplex cued once", Multiplex(newCued("a", "b"), newCued("c")), []string{"a", "b", "c"}},
+		{"rate limit", RateLimit(pushed("a", "b", "c"), 100, 1), []string{"a", "b", "c"}},
+		{"transform", Transform(Multiplex(pushed("a"), pushed("b")), upper), []string{"A", "B"}},
+	}
+	for _, c := range cases {
+		if _, ok := c.s.(Notifier); !ok {
+			t.Errorf("%s: wanted notifier\n", c.name)
+			continue
+		}
+		start := time.Now()
+		got := get(c.s, 10)
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: wanted %v, got %v\n", c.name, c.want, got)
+		}
+		if c.name == "rate limit" && time.Since(start) < 20*time.Millisecond {
+			t.Errorf("wanted 3 data at 100/s taking 20ms at least, took %s\n", time.Since(start))
+		}
+	}
+}
+
+func TestMiddlewareClose(t *testing.T) {
+	cases := []struct {
+		name string
+		wrap func(s Supplier) Source
+	}{
+		{"multiplex", func(s Supplier) Source { return Multiplex(s, pushed("x")) }},
+		{"rate limit", func(s Supplier) Source { return RateLimit(s, 1, 1) }},
+		{"throttle", func(s Supplier) Source { return Throttle(s, 1, 1) }},
+		{"filter", func(s Supplier) Source { return Filter(s, func([]byte) bool { return true }) }},
+		{"tee", func(s Supplier) Source { return Tee(s, func([]byte) error { return nil }) }},
+		{"batch", func(s Supplier) Source { return Batch(s, 2) }},
+	}
+	for _, c := range cases {
+		rd := NewReader(strings.NewReader("a\nb\nc\n"), nil)
+		src := c.wrap(rd)
+		closer, ok := src.(io.Closer)
+		nt, _ := src.(Notifier)
+		if !ok || nt == nil {
+			t.Errorf("%s: wanted closer and notifier\n", c.name)
+			continue
+		}
+		closed := make(chan util.Cue)
+		go func() { // nothing consumed, the cues of the reader are pending
+			defer close(closed)
+			closer.Close()
+			for range rd.Notify() {
+			}
+			for range nt.Notify() {
+			}
+		}()
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Errorf("%s: wanted closed\n", c.name)
+		}
+	}
+}
+
+func TestRateLimitPushedNoWait(t *testing.T) {
+	src := RateLimit(pushed("a", "b"), 1, 1)
+	defer src.(io.Closer).Close()
+	buf := bytebuffer.New(64)
+	<-src.(Notifier).Notify()
+	start := time.Now()
+	src.Supply(buf)
+	if n, err := src.Supply(buf); n != 0 || err != nil {
+		t.Errorf("wanted nothing supplied for now, got %d and %v\n", n, err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("wanted no waiting for the next token, took %s\n", d)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	src := Batch(newItems("a", "bb", "ccc"), 8)
+	buf := bytebuffer.New(64)
+	n, err := src.Supply(buf)
+	if err != io.EOF {
+		t.Errorf("wanted %v, got %v\n", io.EOF, err)
+	}
+	dats, err := Split(buf.Flip().GetN(n))
+	if err != nil || len(dats) != 3 || string(dats[0]) != "a" || string(dats[1]) != "bb" || string(dats[2]) != "ccc" {
+		t.Errorf("wanted [a bb ccc], got %q, %v\n", dats, err)
+	}
+	if _, err := Split([]byte{0, 0, 0, 2, 'a'}); err != io.ErrUnexpectedEOF {
+		t.Errorf("wanted %v, got %v\n", io.ErrUnexpectedEOF, err)
+	}
+}
@@ -0,0 +1,107 @@
+package supplier
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/util"
+)
+
+// pusher hands data produced by a goroutine to Get, cueing the consumer for
+// each. It is the base of the push suppliers in this package.
+type pusher struct {
+	pending chan []byte
+	notify  chan util.Cue
+	done    chan util.Cue
+	ended   chan util.Cue // closed by finish
+	once    sync.Once
+	err     error // io.EOF or why pushing ended, valid once ended
+}
+
+func newPusher() pusher {
+	return pusher{pending: make(chan []byte, 1), notify: make(chan util.Cue, 1),
+		done: make(chan util.Cue), ended: make(chan util.Cue)}
+}
+
+// push waits until dat can be handed over, returns false if the supplier was
+// closed meanwhile.
+func (p *pusher) push(dat []byte) bool {
+	select {
+	case p.pending <- dat:
+	case <-p.done:
+		return false
+	}
+	select {
+	case p.notify <- util.Cue{}:
+	default: // already notified
+	}
+	return true
+}
+
+// finish denotes that no more data will be pushed because of err, nil for
+// the end of data.
+func (p *pusher) finish(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.err = err
+	close(p.ended)
+	close(p.notify)
+}
+
+// Get writes the data pushed, if any, which must fit into buf.
+func (p *pusher) Get(buf bytebuffer.ByteBuffer) {
+	if _, err := p.Supply(buf); err != nil && err != io.EOF {
+		util.Lw.Printf("failed supplying: %s\n", err)
+	}
+}
+
+// Supply writes the data pushed, if any. Data not fitting into buf is
+// discarded with bytebuffer.ErrOverflow. io.EOF or the error pushing ended
+// with is returned after the last data.
+func (p *pusher) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	select {
+	case dat := <-p.pending:
+		if len(dat) > buf.Remaining() {
+			return 0, fmt.Errorf("discarded data of %d byte(s): %w", len(dat), bytebuffer.ErrOverflow)
+		}
+		buf.PutN(dat)
+		return len(dat), nil
+	default:
+	}
+	select {
+	case <-p.ended:
+		if len(p.pending) > 0 { // pushed before ending
+			return p.Supply(buf)
+		}
+		return 0, p.err
+	default:
+		return 0, nil
+	}
+}
+
+// failure returns the error pushing ended with, nil if ended at the end of
+// data or not ended yet.
+func (p *pusher) failure() error {
+	select {
+	case <-p.ended:
+		if p.err == io.EOF {
+			return nil
+		}
+		return p.err
+	default:
+		return nil
+	}
+}
+
+func (p *pusher) Notify() <-chan util.Cue {
+	return p.notify
+}
+
+// Close stops pushing data.
+func (p *pusher) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
@@ -0,0 +1,74 @@
+package supplier
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/kenix/gomad/bytebuffer"
+)
+
+// RandomTicks supplies a tick of a random symbol per Get as a line of text:
+//
+//	symbol bid ask size timestamp
+//
+// or encoded by Tick.Encode if Binary. Mid prices walk randomly, timestamps
+// are in RFC 3339 format with nanoseconds.
+type RandomTicks struct {
+	Spread     float64          // relative spread between bid and ask
+	Volatility float64          // standard deviation of the relative price change per tick
+	Now        func() time.Time // clock of the timestamps
+	Binary     bool
+
+	symbols []string
+	mids    []float64
+	rnd     *rand.Rand
+}
+
+// NewRandomTicks creates random ticks for symbols, starting at mid prices
+// between 1 and 2. Ticks of the same seed are the same.
+func NewRandomTicks(seed int64, symbols ...string) *RandomTicks {
+	rt := &RandomTicks{Spread: 0.0001, Volatility: 0.0001, Now: time.Now,
+		symbols: symbols, mids: make([]float64, len(symbols)),
+		rnd: rand.New(rand.NewSource(seed))}
+	for i := range rt.mids {
+		rt.mids[i] = 1 + rt.rnd.Float64()
+	}
+	return rt
+}
+
+func (rt *RandomTicks) Get(buf bytebuffer.ByteBuffer) {
+	rt.Supply(buf)
+}
+
+// Supply writes the next tick, it is exhausted only without symbols. Text
+// ticks are truncated by a buffer too small, binary ones fail with
+// bytebuffer.ErrOverflow.
+func (rt *RandomTicks) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	if len(rt.symbols) == 0 {
+		return 0, io.EOF
+	}
+	t := rt.Next()
+	if !rt.Binary {
+		return fmt.Fprintf(buf, "%s %.5f %.5f %d %s", t.Symbol, t.Bid, t.Ask, t.Volume,
+			t.Time.UTC().Format(time.RFC3339Nano))
+	}
+	if err := t.Encode(buf); err != nil {
+		return 0, err
+	}
+	return t.Len(), nil
+}
+
+// Next returns the next tick, traded at bid or ask, panics without symbols.
+func (rt *RandomTicks) Next() Tick {
+	i := rt.rnd.Intn(len(rt.symbols))
+	rt.mids[i] *= 1 + rt.rnd.NormFloat64()*rt.Volatility
+	half := rt.mids[i] * rt.Spread / 2
+	t := Tick{Symbol: rt.symbols[i], Time: rt.Now(), Bid: rt.mids[i] - half,
+		Ask: rt.mids[i] + half, Volume: uint64(1+rt.rnd.Intn(100)) * 10000}
+	if t.Last = t.Bid; rt.rnd.Intn(2) == 1 {
+		t.Last = t.Ask
+	}
+	return t
+}
@@ -0,0 +1,61 @@
+package supplier
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/kenix/gomad/util"
+)
+
+// Reader is a push supplier of the tokens, lines by default, read from an
+// io.Reader, one per Get. It stops at the end of input.
+type Reader struct {
+	pusher
+}
+
+// NewReader starts reading tokens split by split from r, lines if split is
+// nil.
+func NewReader(r io.Reader, split bufio.SplitFunc) *Reader {
+	rd := &Reader{pusher: newPusher()}
+	go rd.run(r, split)
+	return rd
+}
+
+// OpenFile starts reading lines from the file at path, closing it at the end.
+func OpenFile(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rd := &Reader{pusher: newPusher()}
+	go func() {
+		defer f.Close()
+		rd.run(f, nil)
+	}()
+	return rd, nil
+}
+
+func (rd *Reader) run(r io.Reader, split bufio.SplitFunc) {
+	scanner := bufio.NewScanner(r)
+	if split != nil {
+		scanner.Split(split)
+	}
+	for scanner.Scan() {
+		if !rd.push(append([]byte(nil), scanner.Bytes()...)) {
+			rd.finish(nil)
+			return
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		util.Le.Printf("failed reading: %s\n", err)
+	}
+	rd.finish(err)
+}
+
+// Err returns the error reading stopped with, nil if stopped at the end or
+// still reading.
+func (rd *Reader) Err() error {
+	return rd.failure()
+}
@@ -0,0 +1,94 @@
+package supplier
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/sdb"
+	"github.com/kenix/gomad/util"
+)
+
+// Keys returns the next key, false if there are no more.
+type Keys func() (string, bool)
+
+// KeyList returns keys in the order given.
+func KeyList(keys ...string) Keys {
+	return func() (string, bool) {
+		if len(keys) == 0 {
+			return "", false
+		}
+		key := keys[0]
+		keys = keys[1:]
+		return key, true
+	}
+}
+
+// SeqKeys returns the keys formatted by format, e.g. "%020d", of the sequence
+// numbers from first to last.
+func SeqKeys(format string, first, last uint64) Keys {
+	next, done := first, first > last
+	return func() (string, bool) {
+		if done {
+			return "", false
+		}
+		seq := next
+		next++
+		done = seq == last
+		return fmt.Sprintf(format, seq), true
+	}
+}
+
+// SDB supplies the data stored in an sdb file under keys, one per Get. Keys
+// without data are skipped.
+type SDB struct {
+	r    sdb.Reader
+	keys Keys
+	err  error
+}
+
+// NewSDB creates a supplier of the data read from r under keys.
+func NewSDB(r sdb.Reader, keys Keys) *SDB {
+	return &SDB{r: r, keys: keys}
+}
+
+func (s *SDB) Get(buf bytebuffer.ByteBuffer) {
+	if _, err := s.Supply(buf); err != nil && err != io.EOF {
+		util.Lw.Printf("failed supplying: %s\n", err)
+	}
+}
+
+// Supply writes the data of the next key found. Data not fitting into buf is
+// skipped with bytebuffer.ErrOverflow. io.EOF is returned after the last key,
+// once reading failed the error is returned for good.
+func (s *SDB) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	for s.err == nil {
+		key, ok := s.keys()
+		if !ok {
+			s.err = io.EOF
+			break
+		}
+		dat, err := s.r.Get(key)
+		if err != nil {
+			s.err = fmt.Errorf("failed reading %s from %s: %w", key, s.r.Underlying(), err)
+			break
+		}
+		if dat == nil {
+			continue
+		}
+		if len(dat) > buf.Remaining() {
+			return 0, fmt.Errorf("skipped %s of %d byte(s): %w", key, len(dat), bytebuffer.ErrOverflow)
+		}
+		buf.PutN(dat)
+		return len(dat), nil
+	}
+	return 0, s.err
+}
+
+// Err returns the error reading failed with, no more data is supplied then.
+func (s *SDB) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
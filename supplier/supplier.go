@@ -2,8 +2,52 @@ package supplier
 
 import (
 	"github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/util"
 )
 
 type Supplier interface {
 	Get(bytebuffer.ByteBuffer)
 }
+
+// Source is a Supplier reporting the number of bytes it wrote into the buffer
+// and why it failed to supply. It returns io.EOF once exhausted, possibly
+// along with its last data. Data written along with other errors is valid,
+// too, and the source may be asked again.
+type Source interface {
+	Supplier
+	Supply(buf bytebuffer.ByteBuffer) (n int, err error)
+}
+
+// Failer is implemented by sources failing for good, e.g. when their input
+// breaks. Err returns the error they failed with once it is returned by
+// Supply, nil at the end of data.
+type Failer interface {
+	Err() error
+}
+
+// AsSource returns s if it is a Source, otherwise a Source never failing nor
+// exhausted, reporting what s wrote by the change of the buffer's position.
+// The adapter doesn't implement Notifier, even if s does.
+func AsSource(s Supplier) Source {
+	if src, ok := s.(Source); ok {
+		return src
+	}
+	return source{s}
+}
+
+type source struct {
+	Supplier
+}
+
+func (s source) Supply(buf bytebuffer.ByteBuffer) (int, error) {
+	p := buf.Position()
+	s.Get(buf)
+	return buf.Position() - p, nil
+}
+
+// Notifier is implemented by suppliers pushing data instead of being polled. A
+// cue is sent on the returned channel whenever new data is available, closing
+// the channel denotes no more data.
+type Notifier interface {
+	Notify() <-chan util.Cue
+}
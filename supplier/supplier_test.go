@@ -0,0 +1,218 @@
+package supplier
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kenix/gomad/bytebuffer"
+	"github.com/kenix/gomad/sdb"
+	"github.com/kenix/gomad/util"
+)
+
+func init() {
+	util.InitLoggers(ioutil.Discard)
+}
+
+// get returns what s supplies per Get as strings, n at most.
+func get(s Supplier, n int) []string {
+	var got []string
+	buf := bytebuffer.New(64)
+	for len(got) < n {
+		if nt, ok := s.(Notifier); ok {
+			if _, ok := <-nt.Notify(); !ok {
+				break
+			}
+		}
+		s.Get(buf)
+		if buf.Flip().HasRemaining() {
+			got = append(got, string(buf.GetN(buf.Remaining())))
+		} else if _, ok := s.(Notifier); !ok {
+			break
+		}
+		buf.Clear()
+	}
+	return got
+}
+
+func TestRandomTicks(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	rt := NewRandomTicks(1, "EURUSD", "USDJPY")
+	rt.Now = func() time.Time { return now }
+	ticks := get(rt, 100)
+	if len(ticks) != 100 {
+		t.Fatalf("wanted 100 ticks, got %d\n", len(ticks))
+	}
+	for _, tick := range ticks {
+		var sym, ts string
+		var bid, ask float64
+		var size int
+		if _, err := fmt.Sscan(tick, &sym, &bid, &ask, &size, &ts); err != nil {
+			t.Fatalf("%s: %s\n", tick, err)
+		}
+		if sym != "EURUSD" && sym != "USDJPY" || bid >= ask || size <= 0 ||
+			ts != now.Format(time.RFC3339Nano) {
+			t.Errorf("wanted valid tick, got %s\n", tick)
+		}
+	}
+	if again := get(NewRandomTicks(1, "EURUSD", "USDJPY"), 1); again[0][:22] != ticks[0][:22] {
+		t.Errorf("wanted %s, got %s\n", ticks[0][:22], again[0][:22])
+	}
+}
+
+func TestPushSuppliers(t *testing.T) {
+	ch := make(chan []byte, 3)
+	for _, s := range []string{"a", "b", "c"} {
+		ch <- []byte(s)
+	}
+	close(ch)
+
+	cases := []struct {
+		name string
+		s    Supplier
+		want []string
+	}{
+		{"lines", NewReader(strings.NewReader("a\nb\nc\n"), nil), []string{"a", "b", "c"}},
+		{"words", NewReader(strings.NewReader("a b  c"), bufio.ScanWords), []string{"a", "b", "c"}},
+		{"chan", NewChan(ch), []string{"a", "b", "c"}},
+	}
+	for _, c := range cases {
+		if got := get(c.s, 10); strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: wanted %v, got %v\n", c.name, c.want, got)
+		}
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	rd := NewReader(strings.NewReader("a\nb\nc\n"), nil)
+	<-rd.Notify()
+	rd.Close()
+	for range rd.Notify() { // finishes after closing
+	}
+	if rd.Err() != nil {
+		t.Errorf("wanted no error, got %v\n", rd.Err())
+	}
+}
+
+func TestErrWhilePushing(t *testing.T) {
+	tooLong := strings.Repeat("x", 1<<17) // for the scanners
+	cases := []struct {
+		name string
+		s    interface {
+			Failer
+			Notifier
+		}
+	}{
+		{"reader", NewReader(strings.NewReader("a\n"+tooLong), nil)},
+		{"ticks", NewJSONTicks(strings.NewReader(`{"symbol":"A"}`+"\n"+tooLong), DefaultTickFormat())},
+	}
+	for _, c := range cases {
+		c.s.Err() // racing with pushing
+		for range c.s.Notify() {
+		}
+		if c.s.Err() == nil {
+			t.Errorf("%s: wanted error, got nil\n", c.name)
+		}
+	}
+}
+
+// writeSDB writes the sequence numbers given under their zero padded keys
+// into an sdb file, returns its path.
+func writeSDB(t *testing.T, seqs ...uint64) string {
+	path := filepath.Join(t.TempDir(), "supplier.sdb")
+	w, err := sdb.NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range seqs {
+		w.Put(fmt.Sprintf("%020d", seq), []byte(fmt.Sprint(seq)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSDB(t *testing.T) {
+	r, err := sdb.NewReader(writeSDB(t, 1, 2, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cases := []struct {
+		keys Keys
+		want []string
+	}{
+		{SeqKeys("%020d", 1, 5), []string{"1", "2", "4"}},
+		{SeqKeys("%020d", 2, 2), []string{"2"}},
+		{SeqKeys("%020d", 3, 2), nil},
+		{KeyList(fmt.Sprintf("%020d", 4), "x", fmt.Sprintf("%020d", 1)), []string{"4", "1"}},
+	}
+	for _, c := range cases {
+		if got := get(NewSDB(r, c.keys), 10); strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("wanted %v, got %v\n", c.want, got)
+		}
+	}
+}
+
+type getter string
+
+func (g getter) Get(buf bytebuffer.ByteBuffer) {
+	buf.Write([]byte(g))
+}
+
+func TestSupply(t *testing.T) {
+	ch := make(chan []byte, 1)
+	ch <- []byte("toolong")
+	close(ch)
+	r, err := sdb.NewReader(writeSDB(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cases := []struct {
+		name string
+		s    Source
+		want []string // data or errors supplied until io.EOF
+	}{
+		{"adapter", AsSource(getter("ab")), []string{"ab", "ab", "ab"}},
+		{"random", NewRandomTicks(1), nil},
+		{"reader", NewReader(strings.NewReader("a\nb"), nil), []string{"a", "b"}},
+		{"overflow", NewChan(ch), []string{"overflow"}},
+		{"sdb", NewSDB(r, SeqKeys("%020d", 1, 2)), []string{"1"}},
+	}
+	for _, c := range cases {
+		var got []string
+		buf := bytebuffer.New(4)
+		for len(got) < 3 {
+			n, err := c.s.Supply(buf)
+			if err == io.EOF {
+				break
+			}
+			switch {
+			case errors.Is(err, bytebuffer.ErrOverflow):
+				got = append(got, "overflow")
+			case err != nil:
+				t.Fatalf("%s: %s\n", c.name, err)
+			case n != buf.Position():
+				t.Errorf("%s: wanted %d byte(s), got %d\n", c.name, buf.Position(), n)
+			case n > 0:
+				got = append(got, string(buf.Flip().GetN(n)))
+			default:
+				time.Sleep(time.Millisecond) // pushed data pending
+			}
+			buf.Clear()
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: wanted %v, got %v\n", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package supplier
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kenix/gomad/bytebuffer"
+)
+
+// TickVersion is the version of the tick encoding written. Versions only
+// append fields, decoders skip the fields they don't know.
+const TickVersion = 1
+
+// tickHeader is the size of an encoded tick without symbol and fields of
+// later versions: version, length, symbol length, time, bid, ask, last and
+// volume.
+const tickHeader = 1 + 2 + 1 + 8 + 8 + 8 + 8 + 8
+
+// MaxSymbolLength is the maximum length of a tick's symbol.
+const MaxSymbolLength = math.MaxUint8
+
+var ErrTick = errors.New("supplier: malformed tick")
+
+// Tick is a price quote of a symbol, encoded in network byte order as:
+//
+//	version(1) length(2) symbol length(1) symbol time(8) bid(8) ask(8) last(8) volume(8)
+//
+// length counts the bytes following it, time is in nanoseconds since epoch,
+// 0 for the zero time, prices are IEEE 754 binary64.
+type Tick struct {
+	Symbol string
+	Time   time.Time
+	Bid    float64
+	Ask    float64
+	Last   float64
+	Volume uint64
+}
+
+func (t *Tick) String() string {
+	return fmt.Sprintf("%s %.5f %.5f %.5f %d %s", t.Symbol, t.Bid, t.Ask, t.Last,
+		t.Volume, t.Time.UTC().Format(time.RFC3339Nano))
+}
+
+// Len returns the encoded length of the tick.
+func (t *Tick) Len() int {
+	return tickHeader + len(t.Symbol)
+}
+
+// Encode writes the tick into buf, fails with bytebuffer.ErrOverflow if buf
+// cannot hold it.
+func (t *Tick) Encode(buf bytebuffer.ByteBuffer) error {
+	if len(t.Symbol) > MaxSymbolLength {
+		return ErrTick
+	}
+	if t.Len() > buf.Remaining() {
+		return bytebuffer.ErrOverflow
+	}
+	var ns int64
+	if !t.Time.IsZero() {
+		ns = t.Time.UnixNano()
+	}
+	o := buf.Order()
+	defer buf.OrderTo(o)
+	buf.OrderTo(binary.BigEndian).Put(TickVersion).PutUint16(uint16(t.Len() - 3)).
+		Put(byte(len(t.Symbol))).PutN([]byte(t.Symbol)).PutInt64(ns).
+		PutFloat64(t.Bid).PutFloat64(t.Ask).PutFloat64(t.Last).PutUint64(t.Volume)
+	return nil
+}
+
+// Bytes returns the encoded tick.
+func (t *Tick) Bytes() []byte {
+	buf := bytebuffer.New(t.Len())
+	if err := t.Encode(buf); err != nil {
+		panic(err)
+	}
+	return buf.Flip().GetN(buf.Remaining())
+}
+
+// DecodeTick decodes the tick at the start of b, returns it along with the
+// number of bytes consumed.
+func DecodeTick(b []byte) (Tick, int, error) {
+	var t Tick
+	if len(b) < 4 {
+		return t, 0, ErrTick
+	}
+	n := 3 + int(binary.BigEndian.Uint16(b[1:]))
+	if b[0] < 1 || len(b) < n || n < tickHeader+int(b[3]) {
+		return t, 0, ErrTick
+	}
+	buf := bytebuffer.Wrap(b[3:n]).OrderTo(binary.BigEndian)
+	t.Symbol = string(buf.GetN(int(buf.Get())))
+	if ns := buf.GetInt64(); ns != 0 {
+		t.Time = time.Unix(0, ns)
+	}
+	t.Bid = buf.GetFloat64()
+	t.Ask = buf.GetFloat64()
+	t.Last = buf.GetFloat64()
+	t.Volume = buf.GetUint64()
+	return t, n, nil
+}
+
+// DecodeTicks decodes all ticks concatenated in b, e.g. the data of a frame.
+// Data batched by Batch is to be Split first.
+func DecodeTicks(b []byte) ([]Tick, error) {
+	var ticks []Tick
+	for len(b) > 0 {
+		t, n, err := DecodeTick(b)
+		if err != nil {
+			return ticks, err
+		}
+		ticks = append(ticks, t)
+		b = b[n:]
+	}
+	return ticks, nil
+}
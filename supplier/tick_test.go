@@ -0,0 +1,87 @@
+package supplier
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kenix/gomad/bytebuffer"
+)
+
+func TestTickCodec(t *testing.T) {
+	ticks := []Tick{
+		{Symbol: "EURUSD", Time: time.Unix(0, 1767225600123456789), Bid: 1.08501,
+			Ask: 1.08512, Last: 1.08512, Volume: 1000000},
+		{Symbol: "", Bid: -1, Ask: 0, Last: 1e300},
+	}
+	for _, tick := range ticks {
+		b := tick.Bytes()
+		if len(b) != tick.Len() {
+			t.Errorf("wanted %d byte(s), got %d\n", tick.Len(), len(b))
+		}
+		got, n, err := DecodeTick(b)
+		if err != nil || n != len(b) || got.String() != tick.String() || !got.Time.Equal(tick.Time) {
+			t.Errorf("wanted %s, got %s, %d, %v\n", &tick, &got, n, err)
+		}
+	}
+
+	buf := bytebuffer.New(2 * ticks[0].Len())
+	ticks[0].Encode(buf)
+	ticks[0].Encode(buf)
+	if err := ticks[0].Encode(buf); err != bytebuffer.ErrOverflow {
+		t.Errorf("wanted %v, got %v\n", bytebuffer.ErrOverflow, err)
+	}
+	got, err := DecodeTicks(buf.Flip().GetN(buf.Remaining()))
+	if err != nil || len(got) != 2 || got[1].Symbol != "EURUSD" {
+		t.Errorf("wanted 2 ticks, got %v, %v\n", got, err)
+	}
+	if err := (&Tick{Symbol: string(make([]byte, 256))}).Encode(buf.Clear()); err != ErrTick {
+		t.Errorf("wanted %v, got %v\n", ErrTick, err)
+	}
+}
+
+func TestTickVersions(t *testing.T) {
+	tick := Tick{Symbol: "EURUSD", Time: time.Unix(1, 0), Bid: 1, Ask: 2, Last: 1, Volume: 3}
+	b := tick.Bytes()
+	later := append(append([]byte(nil), b...), 0xAB, 0xCD) // a field appended
+	later[0], later[2] = 2, b[2]+2
+
+	cases := []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{"current", b, true},
+		{"later", later, true},
+		{"version 0", append([]byte{0}, b[1:]...), false},
+		{"truncated", b[:len(b)-1], false},
+		{"short length", append(append([]byte(nil), b[:2]...), append([]byte{b[2] - 1}, b[3:]...)...), false},
+	}
+	for _, c := range cases {
+		got, n, err := DecodeTick(c.b)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: wanted ok %t, got %v\n", c.name, c.ok, err)
+			continue
+		}
+		if c.ok && (n != len(c.b) || got.String() != tick.String()) {
+			t.Errorf("%s: wanted %s of %d byte(s), got %s of %d\n", c.name, &tick, len(c.b), &got, n)
+		}
+	}
+	if !bytes.Equal(b, tick.Bytes()) {
+		t.Errorf("wanted stable encoding\n")
+	}
+}
+
+func TestRandomTicksBinary(t *testing.T) {
+	rt := NewRandomTicks(1, "EURUSD")
+	rt.Binary = true
+	buf := bytebuffer.New(64)
+	n, err := rt.Supply(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tick, _, err := DecodeTick(buf.Flip().GetN(n))
+	if err != nil || tick.Symbol != "EURUSD" || tick.Bid >= tick.Ask {
+		t.Errorf("wanted EURUSD tick, got %s, %v\n", &tick, err)
+	}
+}